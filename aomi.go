@@ -0,0 +1,282 @@
+// Package aomi converts data between formats from Go code
+// The same detection, conversion and writing path as the CLI :D
+//
+//	err := aomi.Convert(ctx, r, w, aomi.From("yaml"), aomi.To("json"), aomi.Pretty())
+package aomi
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/loveucifer/aomi/pkg/converters"
+	"github.com/loveucifer/aomi/pkg/detector"
+	"github.com/loveucifer/aomi/pkg/formats"
+	"github.com/loveucifer/aomi/pkg/schema"
+)
+
+// DefaultStreamThreshold is the input size above which Convert streams
+// records instead of loading the whole document
+const DefaultStreamThreshold = 4 << 20
+
+// minPeek is how much input is always looked at to detect its format
+const minPeek = 64 << 10
+
+// Convert reads r, converts it and writes the result to w. The source
+// format is detected unless From is given; the target defaults to JSON.
+//
+// Inputs larger than the stream threshold are converted one record at a
+// time when the source parser, every step and the target writer support
+// it (JSON arrays and CSV, built-in steps, JSON and CSV output), so memory
+// stays bounded. Other conversions load the whole document.
+func Convert(ctx context.Context, r io.Reader, w io.Writer, opts ...Option) error {
+	cfg := newConfig(opts)
+
+	in, prefix, complete, err := cfg.peek(r)
+	if err != nil {
+		return err
+	}
+
+	source, err := cfg.source(prefix, complete)
+	if err != nil {
+		return err
+	}
+	target, err := cfg.target()
+	if err != nil {
+		return err
+	}
+	converter := cfg.converter(source.ID, target.ID)
+
+	if !complete || len(prefix) > cfg.streamThreshold {
+		streamed, err := cfg.stream(ctx, in, w, prefix, source, target, converter)
+		if streamed || err != nil {
+			return err
+		}
+	}
+
+	data := prefix
+	if !complete {
+		if data, err = readAll(ctx, in); err != nil {
+			return err
+		}
+	}
+
+	doc, err := cfg.parse(ctx, source, data)
+	if err != nil {
+		return err
+	}
+
+	doc, err = converter.Convert(doc, target.ID)
+	if err != nil {
+		return fmt.Errorf("converting: %v", err)
+	}
+
+	return cfg.write(ctx, w, target, doc)
+}
+
+// Detect returns the format of the data read from r. Large inputs are
+// detected from their beginning. Detect consumes up to
+// DefaultStreamThreshold bytes of r; use DetectReader to read the input
+// afterwards, or seek back to its start.
+func Detect(r io.Reader) (*formats.Format, error) {
+	format, _, err := DetectReader(r)
+	return format, err
+}
+
+// DetectReader is Detect for readers that can't be rewound: it also
+// returns a reader that yields the whole input, the bytes read for
+// detection followed by the rest of r
+func DetectReader(r io.Reader) (*formats.Format, io.Reader, error) {
+	in, prefix, complete, err := newConfig(nil).peek(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	format, err := detect(prefix, complete)
+	if err != nil {
+		return nil, nil, err
+	}
+	return format, in, nil
+}
+
+// Parse reads r into a document, detecting its format unless From is given
+func Parse(r io.Reader, opts ...Option) (*schema.Document, error) {
+	return ParseContext(context.Background(), r, opts...)
+}
+
+// ParseContext is Parse with a context
+func ParseContext(ctx context.Context, r io.Reader, opts ...Option) (*schema.Document, error) {
+	cfg := newConfig(opts)
+
+	data, err := readAll(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+
+	source, err := cfg.source(data, true)
+	if err != nil {
+		return nil, err
+	}
+	return cfg.parse(ctx, source, data)
+}
+
+// ConvertDocument runs the conversion steps of Convert on a parsed
+// document and writes the result in the To format. From, if given, names
+// the format the document was read from for the format-specific steps.
+func ConvertDocument(ctx context.Context, doc *schema.Document, w io.Writer, opts ...Option) error {
+	cfg := newConfig(opts)
+
+	source := detector.Unknown
+	if cfg.from != "" {
+		f, err := cfg.source(nil, true)
+		if err != nil {
+			return err
+		}
+		source = f.ID
+	}
+	target, err := cfg.target()
+	if err != nil {
+		return err
+	}
+
+	doc, err = cfg.converter(source, target.ID).Convert(doc, target.ID)
+	if err != nil {
+		return fmt.Errorf("converting: %v", err)
+	}
+
+	return cfg.write(ctx, w, target, doc)
+}
+
+// Write writes a document in the To format (JSON by default). Conversion
+// steps are not applied; use Convert for the full pipeline.
+func Write(ctx context.Context, w io.Writer, doc *schema.Document, opts ...Option) error {
+	cfg := newConfig(opts)
+
+	target, err := cfg.target()
+	if err != nil {
+		return err
+	}
+	return cfg.write(ctx, w, target, doc)
+}
+
+// peek reads the beginning of r, enough to detect its format and to tell
+// whether it is larger than the stream threshold. The buffer grows with
+// the input, so a small input costs only its size. in yields the whole
+// input again; complete is true when prefix holds all of it.
+func (c *config) peek(r io.Reader) (in io.Reader, prefix []byte, complete bool, err error) {
+	size := c.streamThreshold + 1
+	if size < minPeek {
+		size = minPeek
+	}
+
+	var buf bytes.Buffer
+	_, err = io.CopyN(&buf, r, int64(size))
+	prefix = buf.Bytes()
+	switch err {
+	case nil:
+		return io.MultiReader(bytes.NewReader(prefix), r), prefix, false, nil
+	case io.EOF:
+		return bytes.NewReader(prefix), prefix, true, nil
+	default:
+		return nil, nil, false, fmt.Errorf("reading input: %v", err)
+	}
+}
+
+// source resolves the From format or detects it from the data, which is
+// only a prefix of the input unless complete
+func (c *config) source(data []byte, complete bool) (*formats.Format, error) {
+	if c.from == "" {
+		return detect(data, complete)
+	}
+	f := formats.Lookup(c.from)
+	if f == nil {
+		return nil, fmt.Errorf("unknown input format: %s", c.from)
+	}
+	return f, nil
+}
+
+// target resolves the To format
+func (c *config) target() (*formats.Format, error) {
+	f := formats.Lookup(c.to)
+	if f == nil || f.NewWriter == nil {
+		return nil, fmt.Errorf("unknown target format: %s", c.to)
+	}
+	return f, nil
+}
+
+// parse parses data with a configured parser of the source format
+func (c *config) parse(ctx context.Context, source *formats.Format, data []byte) (*schema.Document, error) {
+	if source.NewParser == nil {
+		return nil, fmt.Errorf("%s input is not supported", source.Name)
+	}
+
+	parser := source.NewParser()
+	if err := c.configureParser(parser); err != nil {
+		return nil, err
+	}
+
+	doc, err := parser.Parse(ctx, bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("parsing input: %v", err) // :0 parsing failed
+	}
+	return doc, nil
+}
+
+// converter builds the conversion pipeline for source -> target
+func (c *config) converter(source, target detector.Format) *converters.Converter {
+	converter := converters.NewConverter(source, target, c.steps...)
+	converter.AutoSteps = c.autoSteps
+	if c.flattenOpts != nil {
+		converter.Flatten = *c.flattenOpts
+	}
+
+	if c.flatten {
+		converter.AddStep(converters.Flatten(converter.Flatten))
+	}
+
+	if c.unflatten {
+		// Same options as flattening, so JSON -> CSV -> JSON round-trips
+		converter.AddStep(converters.Unflatten(converter.Flatten))
+	}
+
+	return converter
+}
+
+// write writes a document with a configured writer of the target format
+func (c *config) write(ctx context.Context, w io.Writer, target *formats.Format, doc *schema.Document) error {
+	writer := target.NewWriter()
+	if err := c.configureWriter(writer); err != nil {
+		return err
+	}
+
+	if err := writer.Write(ctx, w, doc); err != nil {
+		return fmt.Errorf("writing output: %v", err) // :0 writing failed
+	}
+	return nil // :) success
+}
+
+// detect detects the format of data among the registered formats
+func detect(data []byte, complete bool) (*formats.Format, error) {
+	var f *formats.Format
+	if complete {
+		f = formats.Detect(data)
+	} else {
+		f = formats.DetectPrefix(data)
+	}
+	if f == nil {
+		return nil, fmt.Errorf("unknown input format")
+	}
+	return f, nil
+}
+
+// readAll reads r to the end unless ctx is done first
+func readAll(ctx context.Context, r io.Reader) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("reading input: %v", err)
+	}
+	return data, ctx.Err()
+}
@@ -3,31 +3,110 @@
 package main
 
 import (
+	"bufio"
+	"context"
 	"flag"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"math/rand"
 	"os"
 	"path/filepath"
 	"strings"
 
+	"github.com/loveucifer/aomi"
+	"github.com/loveucifer/aomi/pkg/converters"
 	"github.com/loveucifer/aomi/pkg/detector"
+	"github.com/loveucifer/aomi/pkg/formats"
 	"github.com/loveucifer/aomi/pkg/parsers"
 	"github.com/loveucifer/aomi/pkg/schema"
 	"github.com/loveucifer/aomi/pkg/writers"
 )
 
 var (
-	toFormat = flag.String("to", "", "Target format (json, csv, yaml, xml, toml)")
+	toFormat = flag.String("to", "", "Target format ("+strings.Join(formats.Names(), ", ")+")")
 	pretty   = flag.Bool("pretty", false, "Pretty print output")
 	batch    = flag.Bool("batch", false, "Batch process directory")
 	validate = flag.Bool("validate", false, "Validate input format only")
+	split    = flag.Bool("split", false, "Write each document of the input to its own file in the output directory")
+	join     = flag.Bool("join", false, "Join all input files into one multi-document output (last argument)")
 	help     = flag.Bool("help", false, "Show help message")
 	version  = flag.Bool("version", false, "Show version information")
+
+	// Transformation pipeline, applied in the order listed here
+	filters   filterFlags
+	rename    = flag.String("rename", "", "Rename fields (old=new,old2=new2)")
+	coerce    = flag.String("coerce", "", "Coerce field types (field=string|number|integer|float|boolean,...)")
+	selectFld = flag.String("select", "", "Keep only these fields (a,b,c)")
+	flatten   = flag.Bool("flatten", false, "Flatten nested objects for any target format")
+	// CSV input dialect, sniffed unless given
+	inDelimiter = flag.String("in-delimiter", "", "CSV input delimiter (e.g. ';', tab); sniffed if empty")
+	inQuote     = flag.String("in-quote", "", "CSV input quote character (\" or '); sniffed if empty")
+	inHeader    = flag.String("in-header", "auto", "CSV input header row: auto, yes or no")
+	// CSV input types
+	csvInfer = flag.String("csv-infer", "safe", "CSV cell types: none (all strings), safe (strict literals) or aggressive")
+	csvTypes = flag.String("csv-types", "", "CSV column types, overriding --csv-infer (zip=string,active=bool,...)")
+	// CSV output
+	csvDelimiter = flag.String("csv-delimiter", "", "CSV output delimiter (e.g. ';', tab); ',' if empty")
+	csvColumns   = flag.String("csv-columns", "", "CSV columns to write, in order (a,b,c)")
+	csvOrder     = flag.String("csv-order", "first-seen", "CSV column order: first-seen or alpha")
+	csvSample    = flag.Int("csv-sample", 0, "Records scanned for CSV columns (0 = all)")
+	csvKeys      = flag.String("csv-keys", "allow", "Records with differing keys: allow, warn or fail")
+	// Other output formats
+	jsonIndent    = flag.Int("json-indent", 0, "JSON spaces per level (0 = compact, or 2 with --pretty)")
+	xmlRoot       = flag.String("xml-root", "", "XML root element when the data has no single root (default root)")
+	xmlItem       = flag.String("xml-item", "", "XML element for array items without a parent key (default item)")
+	xmlAttrPrefix = flag.String("xml-attr-prefix", "", "Prefix of keys written as XML attributes (default @)")
+	xmlTextKey    = flag.String("xml-text-key", "", "Key written as XML element text (default #text)")
+	yamlIndent    = flag.Int("yaml-indent", 0, "YAML spaces per level, 2 to 9 (0 = 4)")
+	tomlInline    = flag.Bool("toml-inline-tables", false, "Write nested TOML tables inline instead of as [sections]")
+	tomlRoot      = flag.String("toml-root", writers.DefaultTOMLRootKey, "TOML key for a root that isn't a table, e.g. CSV records")
+	tomlNulls     = flag.String("toml-nulls", "omit", "TOML nulls: omit, sentinel or fail")
+	tomlSentinel  = flag.String("toml-null-sentinel", "", "String written for nulls with --toml-nulls sentinel")
+	tomlDatetimes = flag.Bool("toml-datetimes", false, "Write date and time strings as native TOML date-times")
+
+	unflatten = flag.Bool("unflatten", false, "Rebuild nested objects from flattened keys (uses --flatten-sep)")
+	autoSteps = flag.Bool("auto-steps", true, "Apply format-specific steps (e.g. flatten before CSV)")
+
+	flattenSep   = flag.String("flatten-sep", "_", "Separator for flattened keys (e.g. _, ., /)")
+	flattenDepth = flag.Int("flatten-depth", 0, "Levels to flatten; deeper values stay as JSON text (0 = unlimited)")
 )
 
+func init() {
+	flag.Var(&filters, "filter", "Keep records matching field<op>value (=, !=, >, <, >=, <=); repeatable")
+}
+
+// filterFlags collects repeated --filter expressions
+type filterFlags []string
+
+func (f *filterFlags) String() string { return strings.Join(*f, ",") }
+
+func (f *filterFlags) Set(value string) error {
+	*f = append(*f, value)
+	return nil
+}
+
 const versionString = "Aomi v0.1.0 - Universal File Converter"
 
 func main() {
+	// Subcommands have their own flags
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "schema":
+			if err := runSchema(os.Args[2:]); err != nil {
+				fmt.Printf("Schema error: %v\n", err)
+				os.Exit(1)
+			}
+			return
+		case "validate":
+			if err := runValidate(os.Args[2:]); err != nil {
+				fmt.Printf("Validation error: %v\n", err)
+				os.Exit(1)
+			}
+			return
+		}
+	}
+
 	flag.Parse()
 
 	if *help {
@@ -52,7 +131,7 @@ func main() {
 		// Validation mode: just detect format and report
 		err := validateInput(args)
 		if err != nil {
-			fmt.Printf("Validation error: %v\\n", err)
+			fmt.Printf("Validation error: %v\n", err)
 			os.Exit(1)
 		}
 		return
@@ -72,6 +151,32 @@ func main() {
 		return
 	}
 
+	if *split {
+		// Split mode: one output file per document
+		if len(args) != 2 {
+			fmt.Println("Split mode requires an input file and an output directory")
+			os.Exit(1)
+		}
+		if err := processSplit(args[0], args[1], *toFormat, *pretty); err != nil {
+			fmt.Printf("Split error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if *join {
+		// Join mode: all inputs into one stream
+		if len(args) < 2 {
+			fmt.Println("Join mode requires input files and an output file")
+			os.Exit(1)
+		}
+		if err := processJoin(args[:len(args)-1], args[len(args)-1], *toFormat, *pretty); err != nil {
+			fmt.Printf("Join error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	// Single file or piped input mode
 	if isPipeInput() {
 		err := processPipedInput(*toFormat, *pretty)
@@ -111,7 +216,7 @@ func validateInput(inputs []string) error {
 		}
 
 		format := detectorInst.DetectFormat(data)
-		fmt.Printf("%s: %s\\n", input, format.String()) // :D detected format
+		fmt.Printf("%s: %s\n", input, format.String()) // :D detected format
 	}
 
 	return nil
@@ -119,94 +224,136 @@ func validateInput(inputs []string) error {
 
 // processPipedInput handles piped input
 func processPipedInput(targetFormat string, pretty bool) error {
-	data, err := ioutil.ReadAll(os.Stdin)
-	if err != nil {
-		return fmt.Errorf("reading stdin: %v", err)
+	// If not specified, default to JSON for piped output
+	if targetFormat == "" {
+		targetFormat = "json"
 	}
 
-	detectorInst := detector.NewDetector()
-	sourceFormat := detectorInst.DetectFormat(data)
-
-	if sourceFormat == detector.Unknown {
-		return fmt.Errorf("unknown input format")
-	}
-
-	// Parse the input
-	doc, err := parseData(data, sourceFormat)
+	opts, err := conversionOptions(pretty)
 	if err != nil {
-		return fmt.Errorf("parsing input: %v", err)
-	}
-
-	// Convert to target format
-	target := detector.Unknown
-	if targetFormat != "" {
-		target = stringToFormat(targetFormat)
-	} else {
-		// If not specified, default to JSON for piped output
-		target = detector.JSON
-	}
-
-	if target == detector.Unknown {
-		return fmt.Errorf("unknown target format: %s", targetFormat)
+		return err
 	}
 
-	// Write the output
-	output, err := writeData(doc, target, pretty)
-	if err != nil {
-		return fmt.Errorf("writing output: %v", err)
+	output := bufio.NewWriter(os.Stdout)
+	if err := aomi.Convert(context.Background(), os.Stdin, output, append(opts, aomi.To(targetFormat))...); err != nil {
+		return err
 	}
-
-	fmt.Print(string(output))
-	return nil
+	return output.Flush()
 }
 
-// processFile converts a single file
+// processFile converts a single file. Large files are streamed, and the
+// output is written to a temporary file that replaces outputFile at the end.
 func processFile(inputFile, outputFile, targetFormat string, pretty bool) error {
-	data, err := ioutil.ReadFile(inputFile)
+	in, err := os.Open(inputFile)
 	if err != nil {
 		return fmt.Errorf("reading %s: %v", inputFile, err)
 	}
+	defer in.Close()
 
-	detectorInst := detector.NewDetector()
-	sourceFormat := detectorInst.DetectFormat(data)
-
-	if sourceFormat == detector.Unknown {
+	// input replays what detection read, so pipes work as well as files
+	source, input, err := aomi.DetectReader(in)
+	if err != nil {
 		return fmt.Errorf("unknown input format for %s", inputFile)
 	}
 
 	// Determine target format
-	target := sourceFormat
+	target := source
 	if targetFormat != "" {
-		target = stringToFormat(targetFormat)
+		target = formats.Lookup(targetFormat)
 	} else {
 		// Infer from output file extension
-		ext := strings.TrimPrefix(filepath.Ext(outputFile), ".")
-		target = stringToFormat(ext)
+		target = formats.ForPath(outputFile)
 	}
 
-	if target == detector.Unknown {
+	if target == nil {
 		return fmt.Errorf("unknown target format: %s", targetFormat)
 	}
 
-	// Parse the input
-	doc, err := parseData(data, sourceFormat)
+	opts, err := conversionOptions(pretty)
 	if err != nil {
-		return fmt.Errorf("parsing input: %v", err)
+		return err
 	}
+	opts = append(opts, aomi.From(source.Name), aomi.To(target.Name))
 
-	// Write the output
-	output, err := writeData(doc, target, pretty)
+	err = writeOutput(outputFile, func(output io.Writer) error {
+		return aomi.Convert(context.Background(), input, output, opts...)
+	})
 	if err != nil {
-		return fmt.Errorf("writing output: %v", err)
+		return err
+	}
+
+	fmt.Printf("Converted %s (%s) -> %s (%s)\n", inputFile, source.Name, outputFile, target.Name) // :D conversion complete
+	return nil
+}
+
+// writeOutput writes what convert produces to path. A regular file is
+// replaced only once convert succeeds, through a temporary file next to it;
+// devices and pipes such as /dev/stdout are written directly.
+func writeOutput(path string, convert func(io.Writer) error) error {
+	file := path
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		file = resolved // replace the link's target, not the link
+	}
+
+	info, err := os.Stat(file)
+	exists := err == nil
+	if exists && !info.Mode().IsRegular() {
+		out, err := os.OpenFile(file, os.O_WRONLY, 0)
+		if err != nil {
+			return fmt.Errorf("writing %s: %v", path, err)
+		}
+		defer out.Close()
+
+		output := bufio.NewWriter(out)
+		if err := convert(output); err != nil {
+			return err
+		}
+		if err := output.Flush(); err != nil {
+			return fmt.Errorf("writing %s: %v", path, err)
+		}
+		return nil
 	}
 
-	err = ioutil.WriteFile(outputFile, output, 0644)
+	out, err := createTemp(filepath.Dir(file))
 	if err != nil {
-		return fmt.Errorf("writing %s: %v", outputFile, err)
+		return fmt.Errorf("writing %s: %v", path, err)
 	}
+	defer os.Remove(out.Name()) // no-op once renamed
 
-	fmt.Printf("Converted %s (%s) -> %s (%s)\n", inputFile, sourceFormat.String(), outputFile, target.String()) // :D conversion complete
-	return nil
+	output := bufio.NewWriter(out)
+	if err := convert(output); err != nil {
+		out.Close()
+		return err
+	}
+	if err := output.Flush(); err != nil {
+		out.Close()
+		return fmt.Errorf("writing %s: %v", path, err)
+	}
+	if err := out.Close(); err != nil {
+		return fmt.Errorf("writing %s: %v", path, err)
+	}
+	if exists {
+		// Keep the mode of the file being replaced
+		if err := os.Chmod(out.Name(), info.Mode().Perm()); err != nil {
+			return fmt.Errorf("writing %s: %v", path, err)
+		}
+	}
+	if err := os.Rename(out.Name(), file); err != nil {
+		return fmt.Errorf("writing %s: %v", path, err)
+	}
+	return nil // :) replaced
+}
+
+// createTemp creates an empty temporary file in dir with mode 0644, less
+// the umask, like any new output file
+func createTemp(dir string) (*os.File, error) {
+	for {
+		name := filepath.Join(dir, fmt.Sprintf(".aomi-%d", rand.Int63()))
+		out, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0644)
+		if !os.IsExist(err) {
+			return out, err
+		}
+	}
 }
 
 // processBatch processes all files in a directory
@@ -276,74 +423,287 @@ func processBatch(inputDir, outputDir, targetFormat string) error {
 	return nil
 }
 
-// parseData parses data based on its format
-func parseData(data []byte, format detector.Format) (*schema.Document, error) {
-	switch format {
-	case detector.JSON:
-		return (&parsers.JSONParser{}).Parse(data)
-	case detector.CSV:
-		return (&parsers.CSVParser{}).Parse(data)
-	case detector.YAML:
-		return (&parsers.YAMLParser{}).Parse(data)
-	case detector.XML:
-		return (&parsers.XMLParser{}).Parse(data)
-	case detector.TOML:
-		return (&parsers.TOMLParser{}).Parse(data)
+// conversionOptions builds the conversion options from the command line
+// flags; transformation steps run in the order filter, rename, coerce,
+// select, then flatten and unflatten
+func conversionOptions(pretty bool) ([]aomi.Option, error) {
+	var steps []converters.Step
+
+	for _, expr := range filters {
+		predicate, err := converters.ParseFilter(expr)
+		if err != nil {
+			return nil, err
+		}
+		steps = append(steps, converters.Filter(predicate))
+	}
+
+	if *rename != "" {
+		fields, err := parseKeyValueList(*rename)
+		if err != nil {
+			return nil, fmt.Errorf("--rename: %v", err)
+		}
+		steps = append(steps, converters.Rename(fields))
+	}
+
+	if *coerce != "" {
+		pairs, err := parseKeyValueList(*coerce)
+		if err != nil {
+			return nil, fmt.Errorf("--coerce: %v", err)
+		}
+		types := make(map[string]schema.DataType, len(pairs))
+		for field, typeName := range pairs {
+			dataType, err := converters.ParseDataType(typeName)
+			if err != nil {
+				return nil, fmt.Errorf("--coerce: %v", err)
+			}
+			types[field] = dataType
+		}
+		steps = append(steps, converters.Coerce(types))
+	}
+
+	if *selectFld != "" {
+		steps = append(steps, converters.Select(splitList(*selectFld)...))
+	}
+
+	opts := []aomi.Option{
+		aomi.Steps(steps...),
+		aomi.AutoSteps(*autoSteps),
+		aomi.FlattenWith(converters.FlattenOptions{
+			Separator: *flattenSep,
+			MaxDepth:  *flattenDepth,
+		}),
+		aomi.ConfigureParser(configureParser),
+	}
+
+	outputOpts, err := outputOptions()
+	if err != nil {
+		return nil, err
+	}
+	opts = append(opts, outputOpts...)
+	if *flatten {
+		opts = append(opts, aomi.Flatten())
+	}
+	if *unflatten {
+		opts = append(opts, aomi.Unflatten())
+	}
+	if pretty {
+		opts = append(opts, aomi.Pretty())
+	}
+
+	return opts, nil
+}
+
+// parseKeyValueList parses "a=b,c=d" into a map
+func parseKeyValueList(s string) (map[string]string, error) {
+	result := make(map[string]string)
+	for _, pair := range splitList(s) {
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" {
+			return nil, fmt.Errorf("invalid pair %q (want key=value)", pair)
+		}
+		result[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+	}
+	return result, nil
+}
+
+// splitList splits a comma-separated list, dropping empty entries
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// configureParser applies the input flags to parsers they concern
+func configureParser(parser parsers.Parser) error {
+	if p, ok := parser.(*parsers.CSVParser); ok {
+		return configureCSVParser(p)
+	}
+	return nil
+}
+
+// configureCSVParser applies the CSV input flags to a CSV parser
+func configureCSVParser(parser *parsers.CSVParser) error {
+	var err error
+	if parser.Delimiter, err = parseCharFlag(*inDelimiter); err != nil {
+		return fmt.Errorf("--in-delimiter: %v", err)
+	}
+	if parser.Quote, err = parseCharFlag(*inQuote); err != nil {
+		return fmt.Errorf("--in-quote: %v", err)
+	}
+
+	switch strings.ToLower(*inHeader) {
+	case "auto":
+		parser.Header = parsers.HeaderAuto
+	case "yes", "true":
+		parser.Header = parsers.HeaderPresent
+	case "no", "false":
+		parser.Header = parsers.HeaderAbsent
+	default:
+		return fmt.Errorf("unknown --in-header %q (want auto, yes or no)", *inHeader)
+	}
+
+	mode, err := parsers.ParseTypeInference(*csvInfer)
+	if err != nil {
+		return fmt.Errorf("--csv-infer: %v", err)
+	}
+	parser.Types = mode
+
+	if *csvTypes == "" {
+		return nil
+	}
+	pairs, err := parseKeyValueList(*csvTypes)
+	if err != nil {
+		return fmt.Errorf("--csv-types: %v", err)
+	}
+	parser.ColumnTypes = make(map[string]schema.DataType, len(pairs))
+	for column, typeName := range pairs {
+		dataType, err := converters.ParseDataType(typeName)
+		if err != nil {
+			return fmt.Errorf("--csv-types: %v", err)
+		}
+		parser.ColumnTypes[column] = dataType
+	}
+	return nil
+}
+
+// parseCharFlag parses a single-character flag value; "tab" and "\t" mean a
+// tab and an empty value means unset
+func parseCharFlag(value string) (rune, error) {
+	switch value {
+	case "":
+		return 0, nil
+	case "tab", `\t`:
+		return '\t', nil
+	}
+
+	runes := []rune(value)
+	if len(runes) != 1 {
+		return 0, fmt.Errorf("want a single character, got %q", value)
+	}
+	return runes[0], nil
+}
+
+// outputOptions builds the options of every writer from the output flags
+func outputOptions() ([]aomi.Option, error) {
+	csvOpts, err := csvOutputOptions()
+	if err != nil {
+		return nil, err
+	}
+	if *jsonIndent < 0 {
+		return nil, fmt.Errorf("--json-indent must not be negative")
+	}
+	if *yamlIndent != 0 && (*yamlIndent < 2 || *yamlIndent > 9) {
+		return nil, fmt.Errorf("--yaml-indent must be between 2 and 9, got %d", *yamlIndent)
+	}
+
+	tomlOpts, err := tomlOutputOptions()
+	if err != nil {
+		return nil, err
+	}
+
+	opts := []aomi.Option{
+		aomi.CSVOutput(csvOpts),
+		aomi.XMLOutput(writers.XMLOptions{
+			RootTag:    *xmlRoot,
+			ItemTag:    *xmlItem,
+			AttrPrefix: *xmlAttrPrefix,
+			TextKey:    *xmlTextKey,
+		}),
+		aomi.YAMLOutput(writers.YAMLOptions{Indent: *yamlIndent}),
+		aomi.TOMLOutput(tomlOpts),
+	}
+	if *jsonIndent > 0 {
+		opts = append(opts, aomi.JSONOutput(writers.JSONOptions{Indent: *jsonIndent})) // otherwise --pretty decides
+	}
+	return opts, nil
+}
+
+// csvOutputOptions builds the CSV writer options from the CSV output flags
+func csvOutputOptions() (writers.CSVOptions, error) {
+	opts := writers.CSVOptions{
+		Headers:    splitList(*csvColumns),
+		SampleSize: *csvSample,
+		Warn: func(msg string) {
+			fmt.Fprintln(os.Stderr, "Warning:", msg)
+		},
+	}
+
+	var err error
+	if opts.Delimiter, err = parseCharFlag(*csvDelimiter); err != nil {
+		return opts, fmt.Errorf("--csv-delimiter: %v", err)
+	}
+
+	switch strings.ToLower(*csvOrder) {
+	case "first-seen", "first":
+		opts.ColumnOrder = writers.FirstSeenOrder
+	case "alpha", "alphabetical":
+		opts.ColumnOrder = writers.AlphabeticalOrder
 	default:
-		return nil, fmt.Errorf("unsupported format: %s", format.String())
+		return opts, fmt.Errorf("unknown --csv-order %q (want first-seen or alpha)", *csvOrder)
 	}
+
+	switch strings.ToLower(*csvKeys) {
+	case "allow":
+		opts.MixedKeys = writers.AllowMixedKeys
+	case "warn":
+		opts.MixedKeys = writers.WarnMixedKeys
+	case "fail":
+		opts.MixedKeys = writers.FailMixedKeys
+	default:
+		return opts, fmt.Errorf("unknown --csv-keys %q (want allow, warn or fail)", *csvKeys)
+	}
+
+	return opts, nil
 }
 
-// writeData writes document data in the specified format
-func writeData(doc *schema.Document, format detector.Format, pretty bool) ([]byte, error) {
-	switch format {
-	case detector.JSON:
-		writer := &writers.JSONWriter{Indent: pretty}
-		return writer.Write(doc)
-	case detector.CSV:
-		writer := &writers.CSVWriter{}
-		return writer.Write(doc)
-	case detector.YAML:
-		writer := &writers.YAMLWriter{}
-		return writer.Write(doc)
-	case detector.XML:
-		writer := &writers.XMLWriter{}
-		return writer.Write(doc)
-	case detector.TOML:
-		writer := &writers.TOMLWriter{}
-		return writer.Write(doc)
+// tomlOutputOptions builds the TOML writer options from the TOML output flags
+func tomlOutputOptions() (writers.TOMLOptions, error) {
+	opts := writers.TOMLOptions{
+		InlineTables: *tomlInline,
+		RootKey:      *tomlRoot,
+		NullSentinel: *tomlSentinel,
+		Datetimes:    *tomlDatetimes,
+	}
+
+	switch strings.ToLower(*tomlNulls) {
+	case "omit":
+		opts.Nulls = writers.OmitNulls
+	case "sentinel":
+		opts.Nulls = writers.SentinelNulls
+	case "fail":
+		opts.Nulls = writers.FailNulls
 	default:
-		return nil, fmt.Errorf("unsupported format: %s", format.String())
+		return opts, fmt.Errorf("unknown --toml-nulls %q (want omit, sentinel or fail)", *tomlNulls)
 	}
+
+	return opts, nil
 }
 
-// stringToFormat converts a string to a Format
+// stringToFormat looks up a format by name, alias or file extension
 func stringToFormat(s string) detector.Format {
-	switch strings.ToLower(s) {
-	case "json":
-		return detector.JSON
-	case "csv":
-		return detector.CSV
-	case "yaml", "yml":
-		return detector.YAML
-	case "xml":
-		return detector.XML
-	case "toml":
-		return detector.TOML
-	default:
-		return detector.Unknown
+	if f := formats.Lookup(s); f != nil {
+		return f.ID
 	}
+	return detector.Unknown
 }
 
 // printUsage shows the help message
 func printUsage() {
 	fmt.Println(versionString)
-	fmt.Println("Converts between JSON, CSV, YAML, XML, TOML and more formats")
+	fmt.Println("Converts between " + strings.ToUpper(strings.Join(formats.Names(), ", ")) + " formats")
 	fmt.Println()
 	fmt.Println("Usage:")
 	fmt.Println("  aomi [options] input output        # Convert input file to output file")
 	fmt.Println("  aomi --to format < input > output  # Pipe with format")
 	fmt.Println("  aomi --batch input_dir output_dir  # Batch convert directory")
+	fmt.Println("  aomi --split input output_dir      # One file per document of a stream")
+	fmt.Println("  aomi --join in1 in2... output      # Join inputs into one stream")
+	fmt.Println("  aomi schema [input]                # Print inferred JSON Schema")
+	fmt.Println("  aomi validate --schema s.json in   # Validate input against a JSON Schema")
 	fmt.Println()
 	fmt.Println("Options:")
 	flag.PrintDefaults()
@@ -353,4 +713,5 @@ func printUsage() {
 	fmt.Println("  aomi --to yaml data.json           # JSON to YAML")
 	fmt.Println("  cat data.csv | aomi --to json      # Pipe conversion")
 	fmt.Println("  aomi --batch ./in ./out --to json  # Batch conversion")
+	fmt.Println("  aomi --filter 'age>=30' --select name,age users.json out.csv")
 }
@@ -0,0 +1,80 @@
+// Package main implements the Aomi universal file converter
+// The schema command: inferred schema as JSON Schema :D
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/loveucifer/aomi"
+	"github.com/loveucifer/aomi/pkg/jsonschema"
+	"github.com/loveucifer/aomi/pkg/parsers"
+	"github.com/loveucifer/aomi/pkg/schema"
+)
+
+// runSchema implements "aomi schema [options] [input]"
+func runSchema(args []string) error {
+	fs := flag.NewFlagSet("schema", flag.ExitOnError)
+	sample := fs.Int("sample", 0, "Array elements inspected per array (0 = all)")
+	fs.Usage = func() {
+		fmt.Println("Usage: aomi schema [options] [input]   # Print the inferred JSON Schema (stdin if no input)")
+		fmt.Println()
+		fmt.Println("Options:")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	input := ""
+	if fs.NArg() > 0 {
+		input = fs.Arg(0)
+	}
+
+	data, err := readInput(input)
+	if err != nil {
+		return err
+	}
+
+	doc, err := aomi.Parse(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+
+	// The documents of a stream are inferred one by one, then merged
+	var inferred *schema.Schema
+	for _, part := range aomi.SplitDocuments(doc) {
+		partSchema := part.Schema
+		if *sample > 0 {
+			partSchema = parsers.InferSchemaWithOptions(part.Data, parsers.InferOptions{SampleSize: *sample})
+		}
+		inferred = parsers.MergeSchemas(inferred, partSchema)
+	}
+
+	output, err := json.MarshalIndent(jsonschema.Generate(inferred), "", "  ")
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(string(output))
+	return nil
+}
+
+// readInput reads a file, or stdin when the path is empty or "-"
+func readInput(path string) ([]byte, error) {
+	if path == "" || path == "-" {
+		data, err := ioutil.ReadAll(os.Stdin)
+		if err != nil {
+			return nil, fmt.Errorf("reading stdin: %v", err)
+		}
+		return data, nil
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %v", path, err)
+	}
+	return data, nil
+}
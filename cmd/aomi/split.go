@@ -0,0 +1,147 @@
+// Package main implements the Aomi universal file converter
+// Split and join modes: one file per document and back :D
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/loveucifer/aomi"
+	"github.com/loveucifer/aomi/pkg/formats"
+	"github.com/loveucifer/aomi/pkg/schema"
+)
+
+// processSplit writes each document of a multi-document input (such as a
+// YAML stream) to its own file in outputDir: name-1.ext, name-2.ext, ...
+func processSplit(inputFile, outputDir, targetFormat string, pretty bool) error {
+	opts, err := conversionOptions(pretty)
+	if err != nil {
+		return err
+	}
+
+	source, doc, err := parseFile(inputFile, targetFormat, opts)
+	if err != nil {
+		return err
+	}
+
+	target := source
+	if targetFormat != "" {
+		if target = formats.Lookup(targetFormat); target == nil {
+			return fmt.Errorf("unknown target format: %s", targetFormat)
+		}
+	}
+	opts = append(opts, aomi.From(source.Name), aomi.To(target.Name))
+
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		return fmt.Errorf("creating output directory: %v", err)
+	}
+
+	ext := target.Name
+	if len(target.Extensions) > 0 {
+		ext = target.Extensions[0]
+	}
+	base := strings.TrimSuffix(filepath.Base(inputFile), filepath.Ext(inputFile))
+
+	parts := aomi.SplitDocuments(doc)
+	width := len(fmt.Sprint(len(parts)))
+	for i, part := range parts {
+		outputFile := filepath.Join(outputDir, fmt.Sprintf("%s-%0*d.%s", base, width, i+1, ext))
+		err := writeOutput(outputFile, func(output io.Writer) error {
+			return aomi.ConvertDocument(context.Background(), part, output, opts...)
+		})
+		if err != nil {
+			return fmt.Errorf("document %d: %v", i+1, err)
+		}
+	}
+
+	fmt.Printf("Split %s (%s) into %d %s file(s) in %s\n", inputFile, source.Name, len(parts), target.Name, outputDir) // :D
+	return nil
+}
+
+// processJoin writes the documents of all inputs to one output: as a
+// stream for formats that have one (--- separated YAML), and otherwise as
+// the records of every input in one array (JSON, CSV, NDJSON...)
+func processJoin(inputFiles []string, outputFile, targetFormat string, pretty bool) error {
+	opts, err := conversionOptions(pretty)
+	if err != nil {
+		return err
+	}
+
+	if targetFormat == "" {
+		if f := formats.ForPath(outputFile); f != nil {
+			targetFormat = f.Name
+		}
+	}
+
+	var docs []*schema.Document
+	var source *formats.Format
+	mixed := false
+	for _, inputFile := range inputFiles {
+		format, doc, err := parseFile(inputFile, targetFormat, opts)
+		if err != nil {
+			return err
+		}
+		if source != nil && source != format {
+			mixed = true
+		}
+		source = format
+		docs = append(docs, doc)
+	}
+
+	target := source
+	if targetFormat != "" {
+		target = formats.Lookup(targetFormat)
+	}
+	if target == nil {
+		return fmt.Errorf("unknown target format: %s", targetFormat)
+	}
+
+	// Format-specific steps only apply when every input has the same format
+	opts = append(opts, aomi.To(target.Name))
+	if !mixed {
+		opts = append(opts, aomi.From(source.Name))
+	}
+
+	joined, unit := aomi.JoinDocuments(docs...), "documents"
+	if !target.Streams {
+		joined, unit = aomi.JoinRecords(docs...), "records"
+	}
+	err = writeOutput(outputFile, func(output io.Writer) error {
+		return aomi.ConvertDocument(context.Background(), joined, output, opts...)
+	})
+	if err != nil {
+		return err
+	}
+
+	count := len(joined.Data.([]interface{}))
+	fmt.Printf("Joined %d file(s) (%d %s) -> %s (%s)\n", len(inputFiles), count, unit, outputFile, target.Name) // :D
+	return nil
+}
+
+// parseFile detects the format of a file and parses it for the target
+// format (the input format if empty)
+func parseFile(inputFile, targetFormat string, opts []aomi.Option) (*formats.Format, *schema.Document, error) {
+	in, err := os.Open(inputFile)
+	if err != nil {
+		return nil, nil, fmt.Errorf("reading %s: %v", inputFile, err)
+	}
+	defer in.Close()
+
+	source, input, err := aomi.DetectReader(in)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unknown input format for %s", inputFile)
+	}
+
+	if targetFormat == "" {
+		targetFormat = source.Name
+	}
+	doc, err := aomi.Parse(input, append(opts, aomi.From(source.Name), aomi.To(targetFormat))...)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %v", inputFile, err)
+	}
+	return source, doc, nil
+}
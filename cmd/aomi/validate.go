@@ -0,0 +1,104 @@
+// Package main implements the Aomi universal file converter
+// The validate command: check documents against a JSON Schema :0
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/loveucifer/aomi"
+	"github.com/loveucifer/aomi/pkg/jsonschema"
+)
+
+// runValidate implements "aomi validate [--schema file] [inputs...]"
+func runValidate(args []string) error {
+	fs := flag.NewFlagSet("validate", flag.ExitOnError)
+	schemaFile := fs.String("schema", "", "JSON Schema file to validate against")
+	fs.Usage = func() {
+		fmt.Println("Usage: aomi validate [options] [inputs...]   # Check inputs parse (and match --schema); stdin if no input")
+		fmt.Println()
+		fmt.Println("Options:")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	var rules *jsonschema.Schema
+	if *schemaFile != "" {
+		data, err := ioutil.ReadFile(*schemaFile)
+		if err != nil {
+			return fmt.Errorf("reading schema: %v", err)
+		}
+		rules = &jsonschema.Schema{}
+		if err := json.Unmarshal(data, rules); err != nil {
+			return fmt.Errorf("parsing schema %s: %v", *schemaFile, err)
+		}
+	}
+
+	inputs := fs.Args()
+	if len(inputs) == 0 {
+		inputs = []string{"-"}
+	}
+
+	failed := 0
+	for _, input := range inputs {
+		name := input
+		if name == "-" {
+			name = "stdin"
+		}
+
+		data, err := readInput(input)
+		if err != nil {
+			return err
+		}
+
+		format, err := aomi.Detect(bytes.NewReader(data))
+		if err != nil {
+			fmt.Printf("%s: unknown format\n", name)
+			failed++
+			continue
+		}
+
+		doc, err := aomi.Parse(bytes.NewReader(data), aomi.From(format.Name))
+		if err != nil {
+			fmt.Printf("%s (%s): %v\n", name, format.Name, err)
+			failed++
+			continue
+		}
+
+		if rules == nil {
+			fmt.Printf("%s: valid %s\n", name, format.Name) // :D it parses
+			continue
+		}
+
+		// Each document of a stream is validated on its own
+		var violations []string
+		parts := aomi.SplitDocuments(doc)
+		for i, part := range parts {
+			for _, violation := range rules.Validate(part.Data) {
+				if len(parts) > 1 {
+					violations = append(violations, fmt.Sprintf("document %d: %s", i+1, violation.Error()))
+				} else {
+					violations = append(violations, violation.Error())
+				}
+			}
+		}
+		if len(violations) == 0 {
+			fmt.Printf("%s: valid\n", name) // :) matches the schema
+			continue
+		}
+
+		failed++
+		fmt.Printf("%s: %d violation(s)\n", name, len(violations))
+		for _, violation := range violations {
+			fmt.Printf("  %s\n", violation)
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d input(s) failed validation", failed, len(inputs))
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package aomi
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestDetectReader(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{name: "json", input: `{"a":1}`, want: "json"},
+		{name: "yaml", input: "a: 1\nb: [x, y]\n", want: "yaml"},
+		{name: "csv", input: "a,b\n1,2\n3,4\n", want: "csv"},
+		{name: "yaml values with commas", input: "key: value, other\nfoo: bar, baz\n", want: "yaml"},
+		{name: "csv with some keyed cells", input: "note,who\nsee: above,Ann\nok,Bob\n", want: "csv"},
+		{name: "csv with a colon in the header", input: "a: b,c\n1,2\n", want: "csv"},
+		{name: "large json", input: "[" + strings.Repeat(`{"a":1},`, 1<<20) + `{"a":1}]`, want: "json"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// A plain io.Reader can't be rewound
+			format, in, err := DetectReader(io.MultiReader(strings.NewReader(tt.input)))
+			if err != nil {
+				t.Fatalf("DetectReader: %v", err)
+			}
+			if format.Name != tt.want {
+				t.Errorf("format = %s, want %s", format.Name, tt.want)
+			}
+
+			replayed, err := io.ReadAll(in)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(replayed) != tt.input {
+				t.Errorf("replayed %d bytes, want the %d bytes of the input", len(replayed), len(tt.input))
+			}
+		})
+	}
+}
+
+// Small inputs don't pay for a buffer the size of the stream threshold
+func TestConvertSmallInputAllocations(t *testing.T) {
+	input := []byte(`[{"id":1,"name":"a"},{"id":2,"name":"b"}]`)
+	const runs = 10
+
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	for i := 0; i < runs; i++ {
+		var out bytes.Buffer
+		if err := Convert(context.Background(), bytes.NewReader(input), &out, To("csv")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	runtime.ReadMemStats(&after)
+
+	if perRun := (after.TotalAlloc - before.TotalAlloc) / runs; perRun > minPeek {
+		t.Errorf("Convert allocated %d bytes for a %d-byte input, want at most %d", perRun, len(input), minPeek)
+	}
+}
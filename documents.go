@@ -0,0 +1,103 @@
+// Package aomi converts data between formats from Go code
+// Splitting and joining multi-document streams :D
+package aomi
+
+import (
+	"github.com/loveucifer/aomi/pkg/parsers"
+	"github.com/loveucifer/aomi/pkg/schema"
+)
+
+// SplitDocuments returns each document of a stream (such as a YAML file
+// with --- separators) as a document of its own. Any other document is
+// returned alone.
+func SplitDocuments(doc *schema.Document) []*schema.Document {
+	items, ok := doc.Data.([]interface{})
+	if !ok || !doc.Stream {
+		return []*schema.Document{doc}
+	}
+
+	docs := make([]*schema.Document, 0, len(items))
+	for i, item := range items {
+		part := &schema.Document{
+			Schema: parsers.InferSchema(item),
+			Data:   item,
+			Order:  doc.Order.Elem(i),
+		}
+		if len(doc.Nodes) == len(items) && doc.Nodes[i] != nil {
+			part.Nodes = doc.Nodes[i : i+1]
+		}
+		docs = append(docs, part)
+	}
+	return docs
+}
+
+// JoinDocuments joins documents into one stream, in order. Streams add
+// each of their documents rather than nesting.
+func JoinDocuments(docs ...*schema.Document) *schema.Document {
+	joined := []interface{}{}
+	order := schema.NewKeyOrder()
+
+	// Source nodes are kept per document, nil where there are none
+	var nodes []interface{}
+	hasNodes := false
+
+	for _, doc := range docs {
+		documents := []interface{}{doc.Data}
+		if stream, ok := doc.Data.([]interface{}); ok && doc.Stream {
+			documents = stream
+			for i := range stream {
+				order.AddElem(doc.Order.Elem(i))
+			}
+		} else {
+			order.AddElem(doc.Order)
+		}
+		joined = append(joined, documents...)
+
+		if len(doc.Nodes) == len(documents) {
+			nodes = append(nodes, doc.Nodes...)
+			hasNodes = true
+		} else {
+			nodes = append(nodes, make([]interface{}, len(documents))...)
+		}
+	}
+
+	joinedDoc := &schema.Document{
+		Schema: parsers.InferSchema(joined),
+		Data:   joined,
+		Order:  order,
+		Stream: true,
+	}
+	if hasNodes {
+		joinedDoc.Nodes = nodes
+	}
+	return joinedDoc
+}
+
+// JoinRecords joins the records of documents into one array, in order, for
+// targets without document streams (JSON, CSV, NDJSON...). The elements of
+// arrays are records; any other document, or document of a stream, is one.
+func JoinRecords(docs ...*schema.Document) *schema.Document {
+	records := []interface{}{}
+	order := schema.NewKeyOrder()
+
+	for _, doc := range docs {
+		for _, part := range SplitDocuments(doc) {
+			items, ok := part.Data.([]interface{})
+			if !ok {
+				records = append(records, part.Data)
+				order.AddElem(part.Order)
+				continue
+			}
+			for i, item := range items {
+				records = append(records, item)
+				order.AddElem(part.Order.Elem(i))
+			}
+		}
+	}
+
+	return &schema.Document{
+		Schema: parsers.InferSchema(records),
+		Data:   records,
+		Order:  order,
+	}
+}
@@ -0,0 +1,131 @@
+package aomi
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/loveucifer/aomi/pkg/schema"
+	"github.com/loveucifer/aomi/pkg/writers"
+)
+
+func TestSplitDocuments(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		from  string
+		want  []string // each part, written as YAML
+	}{
+		{
+			name:  "yaml stream keeps comments and key order per document",
+			input: "# first\nb: 1\na: 2\n---\n# second\nc: [x, y]\n",
+			from:  "yaml",
+			want:  []string{"# first\nb: 1\na: 2\n", "# second\nc: [x, y]\n"},
+		},
+		{
+			name:  "a single yaml document stays whole",
+			input: "- a: 1\n- a: 2\n",
+			from:  "yaml",
+			want:  []string{"- a: 1\n- a: 2\n"},
+		},
+		{
+			name:  "a json array is one document",
+			input: `[{"b":1,"a":2},{"c":3}]`,
+			from:  "json",
+			want:  []string{"- b: 1\n  a: 2\n- c: 3\n"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parts := SplitDocuments(mustParse(t, tt.input, tt.from))
+			if len(parts) != len(tt.want) {
+				t.Fatalf("SplitDocuments() returned %d documents, want %d", len(parts), len(tt.want))
+			}
+			for i, part := range parts {
+				if got := writeYAML(t, part); got != tt.want[i] {
+					t.Errorf("document %d =\n%s\nwant\n%s", i+1, got, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestJoinDocuments(t *testing.T) {
+	stream := mustParse(t, "# one\na: 1\n---\nb: 2\n", "yaml")
+	object := mustParse(t, `{"d":4,"c":3}`, "json")
+
+	got := writeYAML(t, JoinDocuments(stream, object))
+	want := "# one\na: 1\n---\nb: 2\n---\nd: 4\nc: 3\n"
+	if got != want {
+		t.Errorf("JoinDocuments() =\n%s\nwant\n%s", got, want)
+	}
+
+	// Splitting a joined stream gives back the documents
+	if parts := SplitDocuments(JoinDocuments(stream, object)); len(parts) != 3 {
+		t.Errorf("SplitDocuments(JoinDocuments()) returned %d documents, want 3", len(parts))
+	}
+}
+
+func mustParse(t *testing.T, input, from string) *schema.Document {
+	t.Helper()
+	doc, err := Parse(strings.NewReader(input), From(from), To("yaml"))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	return doc
+}
+
+func writeYAML(t *testing.T, doc *schema.Document) string {
+	t.Helper()
+	var out strings.Builder
+	if err := Write(context.Background(), &out, doc, To("yaml"), YAMLOutput(writers.YAMLOptions{Indent: 2})); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	return out.String()
+}
+
+func TestJoinRecords(t *testing.T) {
+	tests := []struct {
+		name   string
+		inputs []string // JSON, or YAML when it has a ---
+		want   string   // joined, written as JSON
+	}{
+		{
+			name:   "record arrays are concatenated",
+			inputs: []string{`[{"id":1},{"id":2}]`, `[{"id":3}]`},
+			want:   `[{"id":1},{"id":2},{"id":3}]`,
+		},
+		{
+			name:   "objects are one record each",
+			inputs: []string{`{"b":1,"a":2}`, `[{"c":3}]`},
+			want:   `[{"b":1,"a":2},{"c":3}]`,
+		},
+		{
+			name:   "each document of a stream is a record",
+			inputs: []string{"a: 1\n---\na: 2\n", `[{"a":3}]`},
+			want:   `[{"a":1},{"a":2},{"a":3}]`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var docs []*schema.Document
+			for _, input := range tt.inputs {
+				from := "json"
+				if strings.Contains(input, "---") {
+					from = "yaml"
+				}
+				docs = append(docs, mustParse(t, input, from))
+			}
+
+			var out strings.Builder
+			if err := Write(context.Background(), &out, JoinRecords(docs...), To("json")); err != nil {
+				t.Fatalf("Write: %v", err)
+			}
+			if got := out.String(); got != tt.want {
+				t.Errorf("JoinRecords() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,45 @@
+package aomi
+
+import (
+	"testing"
+
+	"github.com/loveucifer/aomi/pkg/converters"
+)
+
+func TestCSVRoundTrip(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		opts  []Option
+	}{
+		{
+			name:  "default separator",
+			input: `[{"id":1,"address":{"city":"Paris","zip":"01234"},"tags":["a","b"]}]`,
+		},
+		{
+			name:  "dot separator",
+			input: `[{"id":1,"address":{"city":"Paris"},"tags":["a","b"]}]`,
+			opts:  []Option{FlattenWith(converters.FlattenOptions{Separator: "."})},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			csv := convertString(t, tt.input, append(tt.opts, From("json"), To("csv"))...)
+			back := convertString(t, csv, append(tt.opts, From("csv"), To("json"), Unflatten())...)
+			if back != tt.input {
+				t.Errorf("json to csv and back = %s, want %s\ncsv:\n%s", back, tt.input, csv)
+			}
+		})
+	}
+}
+
+// CSV headers keep their names unless unflattening is asked for
+func TestCSVHeadersKept(t *testing.T) {
+	const input = "first_name,v1.2,address.city\nAnn,x,Paris\n"
+	const want = `[{"first_name":"Ann","v1.2":"x","address.city":"Paris"}]`
+
+	if got := convertString(t, input, From("csv"), To("json")); got != want {
+		t.Errorf("csv to json = %s, want %s", got, want)
+	}
+}
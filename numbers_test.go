@@ -0,0 +1,56 @@
+package aomi
+
+import "testing"
+
+// Exact numbers are written with the digits they were read with
+func TestExactNumbersWritten(t *testing.T) {
+	const input = `[{"big":1234567890123456789012.5,"price":19.90,"whole":1.0,"n":42,"e":-0.5e-3}]`
+
+	tests := []struct {
+		to   string
+		want string
+	}{
+		{
+			to:   "json",
+			want: `[{"big":1234567890123456789012.5,"price":19.90,"whole":1.0,"n":42,"e":-0.5e-3}]`,
+		},
+		{
+			to:   "ndjson",
+			want: `{"big":1234567890123456789012.5,"price":19.90,"whole":1.0,"n":42,"e":-0.5e-3}` + "\n",
+		},
+		{
+			to:   "yaml",
+			want: "- big: 1234567890123456789012.5\n  price: 19.90\n  whole: 1.0\n  \"n\": 42\n  e: -0.5e-3\n",
+		},
+		{
+			to:   "toml",
+			want: "[[records]]\nbig = 1234567890123456789012.5\nprice = 19.90\nwhole = 1.0\nn = 42\ne = -0.5e-3\n",
+		},
+		{
+			to:   "csv",
+			want: "big,price,whole,n,e\n1234567890123456789012.5,19.90,1.0,42,-0.5e-3\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.to, func(t *testing.T) {
+			if got := convertString(t, input, From("json"), To(tt.to)); got != tt.want {
+				t.Errorf("json to %s =\n%s\nwant\n%s", tt.to, got, tt.want)
+			}
+		})
+	}
+}
+
+// Numbers beyond int64 and float64 come back from a round trip unchanged
+func TestExactNumbersRoundTrip(t *testing.T) {
+	const input = `[{"big":12345678901234567890,"price":19.90,"whole":1.0,"n":42}]`
+
+	for _, format := range []string{"json", "ndjson", "yaml", "csv"} {
+		t.Run(format, func(t *testing.T) {
+			written := convertString(t, input, From("json"), To(format))
+			if got := convertString(t, written, From(format), To("json")); got != input {
+				t.Errorf("json to %s and back = %s, want %s", format, got, input)
+			}
+		})
+	}
+}
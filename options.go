@@ -0,0 +1,182 @@
+// Package aomi converts data between formats from Go code
+// Options for Convert, Parse and Write :)
+package aomi
+
+import (
+	"github.com/loveucifer/aomi/pkg/converters"
+	"github.com/loveucifer/aomi/pkg/detector"
+	"github.com/loveucifer/aomi/pkg/formats"
+	"github.com/loveucifer/aomi/pkg/parsers"
+	"github.com/loveucifer/aomi/pkg/writers"
+)
+
+// Option configures a conversion
+type Option func(*config)
+
+// config collects the options of a call
+type config struct {
+	from, to string
+	pretty   bool
+
+	steps       []converters.Step
+	autoSteps   bool
+	flatten     bool
+	unflatten   bool
+	flattenOpts *converters.FlattenOptions
+
+	streamThreshold int
+
+	parserHooks []func(parsers.Parser) error
+	writerHooks []func(writers.Writer) error
+}
+
+// newConfig applies options over the defaults
+func newConfig(opts []Option) *config {
+	cfg := &config{to: "json", autoSteps: true, streamThreshold: DefaultStreamThreshold}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	return cfg
+}
+
+// From sets the source format by name, alias or extension instead of
+// detecting it
+func From(format string) Option {
+	return func(c *config) { c.from = format }
+}
+
+// To sets the target format by name, alias or extension (default json)
+func To(format string) Option {
+	return func(c *config) { c.to = format }
+}
+
+// Pretty indents the output where the format allows it
+func Pretty() Option {
+	return func(c *config) { c.pretty = true }
+}
+
+// Steps adds transformation steps, run in order between parsing and writing
+func Steps(steps ...converters.Step) Option {
+	return func(c *config) { c.steps = append(c.steps, steps...) }
+}
+
+// AutoSteps turns the format-specific steps (such as flattening before
+// CSV) on or off; they are on by default
+func AutoSteps(enabled bool) Option {
+	return func(c *config) { c.autoSteps = enabled }
+}
+
+// FlattenWith sets the separator and depth used to flatten and unflatten
+// keys (default "_", unlimited)
+func FlattenWith(opts converters.FlattenOptions) Option {
+	return func(c *config) { c.flattenOpts = &opts }
+}
+
+// Flatten flattens nested objects for any target format, after the Steps
+func Flatten() Option {
+	return func(c *config) { c.flatten = true }
+}
+
+// Unflatten rebuilds nested objects from flattened keys with the
+// FlattenWith options, after the Steps. It is off by default, so CSV
+// headers such as first_name or a.b stay as they are.
+func Unflatten() Option {
+	return func(c *config) { c.unflatten = true }
+}
+
+// ConfigureParser adjusts the parser before it runs, e.g. to set CSV or
+// XML options with a type switch
+func ConfigureParser(fn func(parsers.Parser) error) Option {
+	return func(c *config) { c.parserHooks = append(c.parserHooks, fn) }
+}
+
+// ConfigureWriter adjusts the writer before it runs, e.g. to set CSV
+// columns with a type switch
+func ConfigureWriter(fn func(writers.Writer) error) Option {
+	return func(c *config) { c.writerHooks = append(c.writerHooks, fn) }
+}
+
+// JSONOutput sets the options of the JSON writer, overriding Pretty
+func JSONOutput(opts writers.JSONOptions) Option {
+	return ConfigureWriter(func(w writers.Writer) error {
+		if jw, ok := w.(*writers.JSONWriter); ok {
+			jw.JSONOptions = opts
+		}
+		return nil
+	})
+}
+
+// CSVOutput sets the options of the CSV writer
+func CSVOutput(opts writers.CSVOptions) Option {
+	return ConfigureWriter(func(w writers.Writer) error {
+		if cw, ok := w.(*writers.CSVWriter); ok {
+			cw.CSVOptions = opts
+		}
+		return nil
+	})
+}
+
+// XMLOutput sets the options of the XML writer
+func XMLOutput(opts writers.XMLOptions) Option {
+	return ConfigureWriter(func(w writers.Writer) error {
+		if xw, ok := w.(*writers.XMLWriter); ok {
+			xw.XMLOptions = opts
+		}
+		return nil
+	})
+}
+
+// YAMLOutput sets the options of the YAML writer
+func YAMLOutput(opts writers.YAMLOptions) Option {
+	return ConfigureWriter(func(w writers.Writer) error {
+		if yw, ok := w.(*writers.YAMLWriter); ok {
+			yw.YAMLOptions = opts
+		}
+		return nil
+	})
+}
+
+// TOMLOutput sets the options of the TOML writer
+func TOMLOutput(opts writers.TOMLOptions) Option {
+	return ConfigureWriter(func(w writers.Writer) error {
+		if tw, ok := w.(*writers.TOMLWriter); ok {
+			tw.TOMLOptions = opts
+		}
+		return nil
+	})
+}
+
+// StreamThreshold sets the input size in bytes above which Convert streams
+// records when it can (default DefaultStreamThreshold); 0 streams any input
+func StreamThreshold(n int) Option {
+	return func(c *config) { c.streamThreshold = n }
+}
+
+// configureParser keeps YAML nodes for YAML output, so comments and
+// anchors survive, and runs the parser hooks
+func (c *config) configureParser(p parsers.Parser) error {
+	if yp, ok := p.(*parsers.YAMLParser); ok {
+		if target := formats.Lookup(c.to); target != nil && target.ID == detector.YAML {
+			yp.PreserveNodes = true
+		}
+	}
+	for _, configure := range c.parserHooks {
+		if err := configure(p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// configureWriter applies Pretty and runs the writer hooks
+func (c *config) configureWriter(w writers.Writer) error {
+	if jw, ok := w.(*writers.JSONWriter); ok && c.pretty {
+		jw.Indent = 2
+	}
+	for _, configure := range c.writerHooks {
+		if err := configure(w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -3,66 +3,390 @@
 package converters
 
 import (
+	"encoding/json"
 	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
 	"github.com/loveucifer/aomi/pkg/detector"
+	"github.com/loveucifer/aomi/pkg/parsers"
 	"github.com/loveucifer/aomi/pkg/schema"
 )
 
-// Converter handles conversion between different formats
+// Step is a single transformation applied between parsing and writing.
+// A step receives the current document and returns the transformed one,
+// and may change both its Data and its Schema.
+type Step interface {
+	Name() string
+	Apply(doc *schema.Document) (*schema.Document, error)
+}
+
+// RecordStep is a step that can also transform records one at a time, so
+// streaming conversions run it without loading the whole document. All
+// built-in steps are record steps; steps made with NewStep are not.
+type RecordStep interface {
+	Step
+	// ApplyRecord transforms one record and its key order; keep is false
+	// when the record is dropped
+	ApplyRecord(record map[string]interface{}, order *schema.KeyOrder) (result map[string]interface{}, resultOrder *schema.KeyOrder, keep bool, err error)
+}
+
+// Converter handles conversion between different formats by running an
+// ordered pipeline of steps over the parsed document
 type Converter struct {
 	sourceFormat detector.Format
 	targetFormat detector.Format
+	steps        []Step
+
+	// AutoSteps adds the steps implied by the source and target formats
+	// (e.g. flattening before CSV) around the configured steps
+	AutoSteps bool
+
+	// Flatten configures the automatic flattening step
+	Flatten FlattenOptions
 }
 
 // NewConverter creates a new converter instance
-func NewConverter(source, target detector.Format) *Converter {
+func NewConverter(source, target detector.Format, steps ...Step) *Converter {
 	return &Converter{
 		sourceFormat: source,
 		targetFormat: target,
+		steps:        steps,
+		AutoSteps:    true,
+		Flatten:      DefaultFlattenOptions(),
 	}
 }
 
+// AddStep appends steps to the end of the configured pipeline
+func (c *Converter) AddStep(steps ...Step) *Converter {
+	c.steps = append(c.steps, steps...)
+	return c
+}
+
+// Steps returns the full pipeline that Convert runs for the given target
+func (c *Converter) Steps(target detector.Format) []Step {
+	pipeline := append([]Step(nil), c.steps...)
+	if c.AutoSteps {
+		pipeline = append(pipeline, c.targetSteps(target)...)
+	}
+	return pipeline
+}
+
 // Convert converts a document from one format to another
 func (c *Converter) Convert(doc *schema.Document, target detector.Format) (*schema.Document, error) {
-	// In this basic implementation, we'll return the same document
-	// In a full implementation, we'd transform the structure as needed
-	return doc, nil // :) for now, just pass through
+	if target == detector.Unknown {
+		target = c.targetFormat
+	}
+
+	for _, step := range c.Steps(target) {
+		next, err := step.Apply(doc)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", step.Name(), err) // :0 step failed
+		}
+
+		// Steps work on the documents of a stream as records; keep it a
+		// stream, and keep the source nodes for the writer
+		_, isArray := next.Data.([]interface{})
+		keepStream := doc.Stream && !next.Stream && isArray
+		keepNodes := doc.Nodes != nil && next.Nodes == nil
+		if keepStream || keepNodes {
+			carried := *next
+			carried.Stream = carried.Stream || keepStream
+			if keepNodes {
+				carried.Nodes = doc.Nodes
+			}
+			next = &carried
+		}
+		doc = next
+	}
+
+	return doc, nil // :) transformed
+}
+
+// RecordSteps returns the steps for the target as record steps, or false
+// if any of them needs the whole document
+func (c *Converter) RecordSteps(target detector.Format) ([]RecordStep, bool) {
+	if target == detector.Unknown {
+		target = c.targetFormat
+	}
+
+	var steps []RecordStep
+	for _, step := range c.Steps(target) {
+		recordStep, ok := step.(RecordStep)
+		if !ok {
+			return nil, false
+		}
+		steps = append(steps, recordStep)
+	}
+	return steps, true
+}
+
+// ConvertRecord runs record steps on a single record of a stream. Values
+// that aren't objects pass through untouched, as they do in Convert.
+func ConvertRecord(steps []RecordStep, record interface{}, order *schema.KeyOrder) (interface{}, *schema.KeyOrder, bool, error) {
+	obj, ok := record.(map[string]interface{})
+	if !ok {
+		return record, order, true, nil
+	}
+
+	for _, step := range steps {
+		next, nextOrder, keep, err := step.ApplyRecord(obj, order)
+		if err != nil {
+			return nil, nil, false, fmt.Errorf("%s: %v", step.Name(), err) // :0 step failed
+		}
+		if !keep {
+			return nil, nil, false, nil
+		}
+		obj, order = next, nextOrder
+	}
+
+	return obj, order, true, nil
+}
+
+// targetSteps returns the steps that prepare data for a target format
+func (c *Converter) targetSteps(target detector.Format) []Step {
+	switch target {
+	case detector.CSV:
+		return []Step{Flatten(c.Flatten)} // CSV cells can't hold nested values
+	default:
+		return nil
+	}
+}
+
+// FlattenOptions controls how nested structures are flattened
+type FlattenOptions struct {
+	// Separator joins the keys of nested values (default "_")
+	Separator string
+	// MaxDepth limits how many levels are flattened; values nested deeper
+	// are kept as embedded JSON strings. Zero means no limit.
+	MaxDepth int
+}
+
+// DefaultFlattenOptions returns the options used by FlattenForCSV
+func DefaultFlattenOptions() FlattenOptions {
+	return FlattenOptions{Separator: "_"}
 }
 
 // FlattenForCSV flattens nested structures for CSV output
 func FlattenForCSV(data interface{}) map[string]interface{} {
-	// Flatten nested structures for CSV output
-	// user.name -> user_name
-	// address.street -> address_street :0
-	flat := make(map[string]interface{})
+	return FlattenWithOptions(data, DefaultFlattenOptions())
+}
 
+// FlattenWithOptions flattens nested objects and arrays at any depth
+//
+//	{"user": {"name": "Ann"}}  -> user_name
+//	{"tags": ["a", "b"]}       -> tags_0, tags_1
+func FlattenWithOptions(data interface{}, opts FlattenOptions) map[string]interface{} {
+	flat, _ := flattenOrdered(data, nil, opts)
+	return flat
+}
+
+// flattenOrdered flattens data and returns the flat keys in source order
+func flattenOrdered(data interface{}, order *schema.KeyOrder, opts FlattenOptions) (map[string]interface{}, []string) {
+	if opts.Separator == "" {
+		opts.Separator = "_"
+	}
+
+	f := &flattener{flat: make(map[string]interface{}), opts: opts}
 	if m, ok := data.(map[string]interface{}); ok {
-		for k, v := range m {
-			switch val := v.(type) {
-			case map[string]interface{}:
-				// Flatten nested objects
-				for nestedK, nestedV := range val {
-					flat[k+"_"+nestedK] = nestedV
-				}
-			case []interface{}:
-				// Convert arrays to strings for CSV
-				flat[k] = arrayToString(val)
-			default:
-				flat[k] = val
+		for _, k := range order.OrderedKeys(m) {
+			f.add(k, m[k], order.Field(k), 1)
+		}
+	}
+
+	return f.flat, f.keys
+}
+
+// flattener accumulates flattened keys in the order they are produced
+type flattener struct {
+	flat map[string]interface{}
+	keys []string
+	opts FlattenOptions
+}
+
+// add stores value under key, descending into maps and arrays until the
+// configured depth is reached
+func (f *flattener) add(key string, value interface{}, order *schema.KeyOrder, depth int) {
+	tooDeep := f.opts.MaxDepth > 0 && depth > f.opts.MaxDepth
+
+	switch val := value.(type) {
+	case map[string]interface{}:
+		if len(val) > 0 && !tooDeep {
+			for _, nestedK := range order.OrderedKeys(val) {
+				f.add(key+f.opts.Separator+nestedK, val[nestedK], order.Field(nestedK), depth+1)
+			}
+			return
+		}
+		value = embedJSON(val)
+	case []interface{}:
+		if len(val) > 0 && !tooDeep {
+			for i, item := range val {
+				f.add(key+f.opts.Separator+strconv.Itoa(i), item, order.Elem(i), depth+1)
 			}
+			return
 		}
+		value = embedJSON(val)
 	}
 
-	return flat
+	if _, exists := f.flat[key]; !exists {
+		f.keys = append(f.keys, key)
+	}
+	f.flat[key] = value
 }
 
-// arrayToString converts an array to a string representation
-func arrayToString(arr []interface{}) string {
-	var result []string
-	for _, item := range arr {
-		result = append(result, stringOrNumberToString(item))
+// embedJSON keeps a nested value below the flattening depth as JSON text
+func embedJSON(value interface{}) string {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprintf("%v", value) // :0 not representable as JSON
 	}
-	return "[" + stringSliceToString(result, ", ") + "]" // :D array as string
+	return string(encoded)
+}
+
+// UnflattenWithOptions is the reverse of FlattenWithOptions: it splits
+// keys on the separator and rebuilds nested objects, turning objects with
+// keys 0..n-1 back into arrays. Keys that would collide with a value of
+// their own prefix (e.g. "a" next to "a_b") are kept flat.
+func UnflattenWithOptions(data map[string]interface{}, opts FlattenOptions) map[string]interface{} {
+	if opts.Separator == "" {
+		opts.Separator = "_"
+	}
+
+	keys := make([]string, 0, len(data))
+	for k := range data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys) // parents before children, stable collisions
+
+	root := make(map[string]interface{})
+	var conflicts []string
+	for _, key := range keys {
+		parts := strings.Split(key, opts.Separator)
+		if opts.MaxDepth > 0 && len(parts) > opts.MaxDepth+1 {
+			// Deeper levels were embedded as JSON, not flattened
+			parts = strings.SplitN(key, opts.Separator, opts.MaxDepth+1)
+		}
+
+		value := data[key]
+		if s, ok := value.(string); ok && ((opts.MaxDepth > 0 && len(parts) == opts.MaxDepth+1) || s == "{}" || s == "[]") {
+			value = unembedJSON(s)
+		}
+
+		if !insertPath(root, parts, value) {
+			conflicts = append(conflicts, key)
+		}
+	}
+
+	// The record itself stays an object even if its keys look like indexes
+	for k, v := range root {
+		root[k] = restoreArrays(v)
+	}
+	for _, key := range conflicts {
+		root[key] = data[key]
+	}
+	return root
+}
+
+// insertPath stores value at the nested path, reporting false when the
+// path clashes with a value that is already there
+func insertPath(root map[string]interface{}, parts []string, value interface{}) bool {
+	node := root
+	for i, part := range parts {
+		if part == "" && len(parts) > 1 {
+			return false // leading, trailing or doubled separator
+		}
+
+		if i == len(parts)-1 {
+			if _, exists := node[part]; exists {
+				return false
+			}
+			node[part] = value
+			return true
+		}
+
+		child, exists := node[part]
+		if !exists {
+			next := make(map[string]interface{})
+			node[part] = next
+			node = next
+			continue
+		}
+		next, ok := child.(map[string]interface{})
+		if !ok || isEmbedded(child) {
+			return false
+		}
+		node = next
+	}
+	return true
+}
+
+// unflattenOrder rebuilds the nested key order from flat keys in order
+func unflattenOrder(keys []string, opts FlattenOptions) *schema.KeyOrder {
+	if opts.Separator == "" {
+		opts.Separator = "_"
+	}
+
+	root := schema.NewKeyOrder()
+	for _, key := range keys {
+		parts := strings.Split(key, opts.Separator)
+		if opts.MaxDepth > 0 && len(parts) > opts.MaxDepth+1 {
+			parts = strings.SplitN(key, opts.Separator, opts.MaxDepth+1)
+		}
+
+		node := root
+		for i, part := range parts {
+			if _, err := strconv.Atoi(part); err == nil && i > 0 {
+				node = node.AddItem() // indexed part of a restored array
+				continue
+			}
+			node = node.AddKey(part)
+		}
+	}
+	return root
+}
+
+// isEmbedded reports whether a map came from decoding an embedded "{}"
+func isEmbedded(value interface{}) bool {
+	m, ok := value.(map[string]interface{})
+	return ok && len(m) == 0
+}
+
+// restoreArrays converts objects keyed 0..n-1 into arrays, recursively
+func restoreArrays(value interface{}) interface{} {
+	m, ok := value.(map[string]interface{})
+	if !ok || len(m) == 0 {
+		return value
+	}
+
+	for k, v := range m {
+		m[k] = restoreArrays(v)
+	}
+
+	arr := make([]interface{}, len(m))
+	for k, v := range m {
+		i, err := strconv.Atoi(k)
+		if err != nil || i < 0 || i >= len(m) || strconv.Itoa(i) != k {
+			return m // not a dense index: keep as object
+		}
+		arr[i] = v
+	}
+	return arr
+}
+
+// unembedJSON decodes a value that flattening kept as embedded JSON text
+func unembedJSON(s string) interface{} {
+	trimmed := strings.TrimSpace(s)
+	if !strings.HasPrefix(trimmed, "{") && !strings.HasPrefix(trimmed, "[") {
+		return s
+	}
+
+	decoded, err := parsers.ParseBytes(&parsers.JSONParser{}, []byte(trimmed))
+	if err != nil {
+		return s
+	}
+	return decoded.Data
 }
 
 // stringOrNumberToString converts a value to string
@@ -71,23 +395,12 @@ func stringOrNumberToString(v interface{}) string {
 	case string:
 		return val
 	case float64:
-		return fmt.Sprintf("%g", val)
+		return strconv.FormatFloat(val, 'f', -1, 64)
 	case bool:
 		return fmt.Sprintf("%t", val)
+	case time.Time:
+		return val.Format(time.RFC3339Nano)
 	default:
 		return fmt.Sprintf("%v", val)
 	}
 }
-
-// stringSliceToString joins a string slice with a separator
-func stringSliceToString(slice []string, sep string) string {
-	if len(slice) == 0 {
-		return ""
-	}
-
-	result := slice[0]
-	for _, s := range slice[1:] {
-		result += sep + s
-	}
-	return result
-}
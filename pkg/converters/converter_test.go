@@ -0,0 +1,165 @@
+package converters
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+// Flattening and then unflattening with the same options gives the data back
+func TestFlattenRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		opts FlattenOptions
+	}{
+		{
+			name: "default separator",
+			data: `{"address":{"city":"Paris","zip":"75001"},"tags":["a","b"]}`,
+		},
+		{
+			name: "dot separator",
+			data: `{"address":{"city":"Paris"},"tags":["a","b"]}`,
+			opts: FlattenOptions{Separator: "."},
+		},
+		{
+			name: "nested arrays of objects",
+			data: `{"items":[{"id":"1","tags":["x"]},{"id":"2","tags":[]}]}`,
+		},
+		{
+			name: "limited depth embeds JSON",
+			data: `{"a":{"b":{"c":{"d":"x"}}},"e":[["x","y"],["z"]]}`,
+			opts: FlattenOptions{Separator: "_", MaxDepth: 1},
+		},
+		{
+			name: "empty objects and arrays",
+			data: `{"a":{},"b":[],"c":null}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var data map[string]interface{} // strings only: embedded JSON reads back as int64
+			if err := json.Unmarshal([]byte(tt.data), &data); err != nil {
+				t.Fatal(err)
+			}
+
+			flat := FlattenWithOptions(data, tt.opts)
+			if got := UnflattenWithOptions(flat, tt.opts); !reflect.DeepEqual(got, data) {
+				t.Errorf("round trip through %v =\n%v\nwant\n%v", flat, got, data)
+			}
+		})
+	}
+}
+
+func TestFlattenWithOptions(t *testing.T) {
+	data := map[string]interface{}{
+		"user": map[string]interface{}{
+			"name":    "Ann",
+			"address": map[string]interface{}{"city": "Paris"},
+		},
+		"tags":  []interface{}{"a", map[string]interface{}{"k": "v"}},
+		"empty": map[string]interface{}{},
+	}
+
+	tests := []struct {
+		name string
+		opts FlattenOptions
+		want map[string]interface{}
+	}{
+		{
+			name: "default separator and array index keys",
+			want: map[string]interface{}{
+				"user_name":         "Ann",
+				"user_address_city": "Paris",
+				"tags_0":            "a",
+				"tags_1_k":          "v",
+				"empty":             "{}",
+			},
+		},
+		{
+			name: "custom separator",
+			opts: FlattenOptions{Separator: "."},
+			want: map[string]interface{}{
+				"user.name":         "Ann",
+				"user.address.city": "Paris",
+				"tags.0":            "a",
+				"tags.1.k":          "v",
+				"empty":             "{}",
+			},
+		},
+		{
+			name: "max depth embeds deeper values as JSON",
+			opts: FlattenOptions{MaxDepth: 1},
+			want: map[string]interface{}{
+				"user_name":    "Ann",
+				"user_address": `{"city":"Paris"}`,
+				"tags_0":       "a",
+				"tags_1":       `{"k":"v"}`,
+				"empty":        "{}",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := FlattenWithOptions(data, tt.opts); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("FlattenWithOptions() =\n%v\nwant\n%v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUnflattenWithOptions(t *testing.T) {
+	tests := []struct {
+		name string
+		flat map[string]interface{}
+		opts FlattenOptions
+		want string
+	}{
+		{
+			name: "index keys become arrays",
+			flat: map[string]interface{}{"tags_0": "a", "tags_1": "b"},
+			want: `{"tags":["a","b"]}`,
+		},
+		{
+			name: "gaps in the indexes keep an object",
+			flat: map[string]interface{}{"tags_0": "a", "tags_2": "b"},
+			want: `{"tags":{"0":"a","2":"b"}}`,
+		},
+		{
+			name: "record keys stay an object",
+			flat: map[string]interface{}{"0": "a", "1": "b"},
+			want: `{"0":"a","1":"b"}`,
+		},
+		{
+			name: "custom separator",
+			flat: map[string]interface{}{"user.name": "Ann", "user_id": "7"},
+			opts: FlattenOptions{Separator: "."},
+			want: `{"user":{"name":"Ann"},"user_id":"7"}`,
+		},
+		{
+			name: "max depth reads embedded JSON",
+			flat: map[string]interface{}{"a_b": `{"c":"x"}`},
+			opts: FlattenOptions{MaxDepth: 1},
+			want: `{"a":{"b":{"c":"x"}}}`,
+		},
+		{
+			name: "colliding keys stay flat",
+			flat: map[string]interface{}{"a": "x", "a_b": "y"},
+			want: `{"a":"x","a_b":"y"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := json.Marshal(UnflattenWithOptions(tt.flat, tt.opts))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("UnflattenWithOptions() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,400 @@
+// Package converters provides cross-format conversion for Aomi
+// Built-in transformation steps for the conversion pipeline :D
+package converters
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/big"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/loveucifer/aomi/pkg/parsers"
+	"github.com/loveucifer/aomi/pkg/schema"
+)
+
+// funcStep adapts a plain function into a named Step
+type funcStep struct {
+	name string
+	fn   func(doc *schema.Document) (*schema.Document, error)
+}
+
+func (s *funcStep) Name() string { return s.name }
+
+func (s *funcStep) Apply(doc *schema.Document) (*schema.Document, error) {
+	return s.fn(doc)
+}
+
+// NewStep creates a named step from a function, for custom transformations
+func NewStep(name string, fn func(doc *schema.Document) (*schema.Document, error)) Step {
+	return &funcStep{name: name, fn: fn}
+}
+
+// recordFunc transforms a single record along with the key order shared
+// by the records, returning the new record and its key order
+type recordFunc func(record map[string]interface{}, order *schema.KeyOrder) (map[string]interface{}, *schema.KeyOrder, error)
+
+// mapRecords applies fn to every record of the data. Records are the
+// objects of a top-level array, or the data itself when it is an object.
+// Other values pass through untouched. Each record keeps the order produced
+// for it.
+func mapRecords(data interface{}, order *schema.KeyOrder, fn recordFunc) (interface{}, *schema.KeyOrder, error) {
+	switch v := data.(type) {
+	case []interface{}:
+		result := make([]interface{}, 0, len(v))
+		resultOrder := schema.NewKeyOrder()
+		for i, item := range v {
+			record, ok := item.(map[string]interface{})
+			if !ok {
+				result = append(result, item)
+				resultOrder.AddElem(order.Elem(i))
+				continue
+			}
+			mapped, mappedOrder, err := fn(record, order.Elem(i))
+			if err != nil {
+				return nil, nil, fmt.Errorf("record %d: %v", i, err)
+			}
+			result = append(result, mapped)
+			resultOrder.AddElem(mappedOrder)
+		}
+		return result, resultOrder, nil
+	case map[string]interface{}:
+		return fn(v, order)
+	default:
+		return data, order, nil
+	}
+}
+
+// recordStep builds a step that applies fn to every record and re-infers
+// the schema of the result
+func recordStep(name string, fn recordFunc) Step {
+	return &mapStep{name: name, fn: fn}
+}
+
+// mapStep applies a record function to every record, so it works on whole
+// documents and on streams of records alike
+type mapStep struct {
+	name string
+	fn   recordFunc
+}
+
+func (s *mapStep) Name() string { return s.name }
+
+func (s *mapStep) Apply(doc *schema.Document) (*schema.Document, error) {
+	data, order, err := mapRecords(doc.Data, doc.Order, s.fn)
+	if err != nil {
+		return nil, err
+	}
+	return newDocument(data, order), nil
+}
+
+func (s *mapStep) ApplyRecord(record map[string]interface{}, order *schema.KeyOrder) (map[string]interface{}, *schema.KeyOrder, bool, error) {
+	mapped, mappedOrder, err := s.fn(record, order)
+	return mapped, mappedOrder, true, err
+}
+
+// newDocument wraps transformed data with a freshly inferred schema
+func newDocument(data interface{}, order *schema.KeyOrder) *schema.Document {
+	return &schema.Document{
+		Schema: parsers.InferSchema(data),
+		Data:   data,
+		Order:  order,
+	}
+}
+
+// Flatten flattens nested objects and arrays of every record
+func Flatten(opts FlattenOptions) Step {
+	return recordStep("flatten", func(record map[string]interface{}, order *schema.KeyOrder) (map[string]interface{}, *schema.KeyOrder, error) {
+		flat, keys := flattenOrdered(record, order, opts)
+		return flat, schema.NewKeyOrder(keys...), nil
+	})
+}
+
+// Unflatten rebuilds nested objects and arrays from flattened record keys
+func Unflatten(opts FlattenOptions) Step {
+	return recordStep("unflatten", func(record map[string]interface{}, order *schema.KeyOrder) (map[string]interface{}, *schema.KeyOrder, error) {
+		return UnflattenWithOptions(record, opts), unflattenOrder(order.OrderedKeys(record), opts), nil
+	})
+}
+
+// Rename renames record fields from old to new names
+func Rename(fields map[string]string) Step {
+	return recordStep("rename", func(record map[string]interface{}, order *schema.KeyOrder) (map[string]interface{}, *schema.KeyOrder, error) {
+		result := make(map[string]interface{}, len(record))
+		renamedOrder := schema.NewKeyOrder()
+		for _, key := range order.OrderedKeys(record) {
+			newKey := key
+			if renamed, ok := fields[key]; ok {
+				newKey = renamed
+			}
+			result[newKey] = record[key]
+			renamedOrder.AddKey(newKey).Merge(order.Field(key))
+		}
+		return result, renamedOrder, nil
+	})
+}
+
+// Select keeps only the given fields of every record, in the given order
+func Select(fields ...string) Step {
+	return recordStep("select", func(record map[string]interface{}, order *schema.KeyOrder) (map[string]interface{}, *schema.KeyOrder, error) {
+		result := make(map[string]interface{}, len(fields))
+		selectedOrder := schema.NewKeyOrder()
+		for _, field := range fields {
+			if value, ok := record[field]; ok {
+				result[field] = value
+				selectedOrder.AddKey(field).Merge(order.Field(field))
+			}
+		}
+		return result, selectedOrder, nil
+	})
+}
+
+// Predicate decides whether a record is kept by Filter
+type Predicate func(record map[string]interface{}) bool
+
+// Filter keeps only the records of a top-level array that match the
+// predicate. A single object is kept as is or replaced by an empty array.
+func Filter(keep Predicate) Step {
+	return &filterStep{keep: keep}
+}
+
+// filterStep drops the records that don't match a predicate
+type filterStep struct {
+	keep Predicate
+}
+
+func (s *filterStep) Name() string { return "filter" }
+
+func (s *filterStep) Apply(doc *schema.Document) (*schema.Document, error) {
+	switch v := doc.Data.(type) {
+	case []interface{}:
+		result := make([]interface{}, 0, len(v))
+		order := schema.NewKeyOrder()
+		for i, item := range v {
+			if record, ok := item.(map[string]interface{}); !ok || s.keep(record) {
+				result = append(result, item)
+				order.AddElem(doc.Order.Elem(i))
+			}
+		}
+		return newDocument(result, order), nil
+	case map[string]interface{}:
+		if s.keep(v) {
+			return doc, nil
+		}
+		return newDocument([]interface{}{}, nil), nil
+	default:
+		return doc, nil
+	}
+}
+
+func (s *filterStep) ApplyRecord(record map[string]interface{}, order *schema.KeyOrder) (map[string]interface{}, *schema.KeyOrder, bool, error) {
+	return record, order, s.keep(record), nil
+}
+
+// filterOperators lists the comparison operators ParseFilter understands,
+// longest first so that ">=" is not read as ">"
+var filterOperators = []string{"!=", ">=", "<=", "=", ">", "<"}
+
+// plainDecimal matches numbers compared exactly: no exponent, so their
+// size stays that of the text
+var plainDecimal = regexp.MustCompile(`^-?[0-9]+(\.[0-9]+)?$`)
+
+// ParseFilter builds a predicate from an expression such as "age>=30",
+// "city=NYC" or "status!=done". Numbers compare numerically (exactly,
+// unless one side is a float or has an exponent), everything else
+// compares as text. With a numeric operand, values that aren't numbers
+// (text, null) never match >, <, >= or <=.
+func ParseFilter(expr string) (Predicate, error) {
+	for _, op := range filterOperators {
+		i := strings.Index(expr, op)
+		if i <= 0 {
+			continue
+		}
+
+		field := strings.TrimSpace(expr[:i])
+		want := strings.TrimSpace(expr[i+len(op):])
+		return func(record map[string]interface{}) bool {
+			value, ok := record[field]
+			if !ok {
+				return op == "!="
+			}
+			return compareValues(value, want, op)
+		}, nil
+	}
+
+	return nil, fmt.Errorf("invalid filter %q (want field<op>value with one of %s)",
+		expr, strings.Join(filterOperators, " "))
+}
+
+// compareValues compares a record value against a filter operand
+func compareValues(value interface{}, want, op string) bool {
+	got := stringOrNumberToString(value)
+
+	cmp, numeric := compareNumbers(value, got, want)
+	if !numeric {
+		if _, err := strconv.ParseFloat(want, 64); err == nil && op != "=" && op != "!=" {
+			return false // :0 not a number, so not in the range
+		}
+		cmp = strings.Compare(got, want)
+	}
+
+	switch op {
+	case "=":
+		return cmp == 0
+	case "!=":
+		return cmp != 0
+	case ">":
+		return cmp > 0
+	case "<":
+		return cmp < 0
+	case ">=":
+		return cmp >= 0
+	case "<=":
+		return cmp <= 0
+	}
+	return false
+}
+
+// compareNumbers compares a value, formatted as got, with a filter operand
+// as numbers: exactly when both are plain decimals, so 64-bit IDs don't
+// round into each other, and as float64 otherwise. ok is false if either
+// isn't a number.
+func compareNumbers(value interface{}, got, want string) (cmp int, ok bool) {
+	if _, isFloat := value.(float64); !isFloat && plainDecimal.MatchString(got) && plainDecimal.MatchString(want) {
+		gotNum, _ := new(big.Rat).SetString(got)
+		wantNum, _ := new(big.Rat).SetString(want)
+		return gotNum.Cmp(wantNum), true
+	}
+
+	gotNum, errGot := strconv.ParseFloat(got, 64)
+	wantNum, errWant := strconv.ParseFloat(want, 64)
+	if errGot != nil || errWant != nil || math.IsNaN(gotNum) || math.IsNaN(wantNum) {
+		return 0, false
+	}
+	switch {
+	case gotNum < wantNum:
+		return -1, true
+	case gotNum > wantNum:
+		return 1, true
+	}
+	return 0, true
+}
+
+// Coerce converts record fields to the given types
+func Coerce(types map[string]schema.DataType) Step {
+	return recordStep("coerce", func(record map[string]interface{}, order *schema.KeyOrder) (map[string]interface{}, *schema.KeyOrder, error) {
+		result := make(map[string]interface{}, len(record))
+		for key, value := range record {
+			result[key] = value
+		}
+
+		for field, dataType := range types {
+			value, ok := result[field]
+			if !ok || value == nil {
+				continue
+			}
+			coerced, err := coerceValue(value, dataType)
+			if err != nil {
+				return nil, nil, fmt.Errorf("field %s: %v", field, err)
+			}
+			result[field] = coerced
+		}
+		return result, order, nil
+	})
+}
+
+// coerceValue converts a single scalar value to the given type
+func coerceValue(value interface{}, dataType schema.DataType) (interface{}, error) {
+	switch dataType {
+	case schema.String:
+		return stringOrNumberToString(value), nil
+	case schema.Number, schema.Float:
+		switch v := value.(type) {
+		case float64, json.Number:
+			return v, nil // exact numbers stay exact
+		case bool:
+			if v {
+				return float64(1), nil
+			}
+			return float64(0), nil
+		default:
+			num, err := strconv.ParseFloat(strings.TrimSpace(stringOrNumberToString(v)), 64)
+			if err != nil {
+				return nil, fmt.Errorf("cannot coerce %v to %s", value, dataType)
+			}
+			return num, nil
+		}
+	case schema.Integer:
+		switch v := value.(type) {
+		case bool:
+			if v {
+				return int64(1), nil
+			}
+			return int64(0), nil
+		case float64:
+			if v != math.Trunc(v) {
+				return nil, fmt.Errorf("cannot coerce %v to integer without losing its fraction", v)
+			}
+			// -2^63 converts exactly, 2^63 is already out of range
+			if v < math.MinInt64 || v >= math.MaxInt64 {
+				return nil, fmt.Errorf("cannot coerce %v to integer: out of the 64-bit range", v)
+			}
+			return int64(v), nil
+		case json.Number:
+			exact, ok := new(big.Rat).SetString(v.String())
+			if !ok || !exact.IsInt() {
+				return nil, fmt.Errorf("cannot coerce %v to integer without losing its fraction", v)
+			}
+			if exact.Num().IsInt64() {
+				return exact.Num().Int64(), nil
+			}
+			return json.Number(exact.Num().String()), nil // beyond int64, keep every digit
+		default:
+			num, err := strconv.ParseInt(strings.TrimSpace(stringOrNumberToString(v)), 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("cannot coerce %v to integer", value)
+			}
+			return num, nil
+		}
+	case schema.Boolean:
+		switch v := value.(type) {
+		case bool:
+			return v, nil
+		case float64:
+			return v != 0, nil
+		case int64:
+			return v != 0, nil
+		case json.Number:
+			exact, ok := new(big.Rat).SetString(v.String())
+			return ok && exact.Sign() != 0, nil
+		default:
+			b, err := strconv.ParseBool(strings.TrimSpace(stringOrNumberToString(v)))
+			if err != nil {
+				return nil, fmt.Errorf("cannot coerce %v to boolean", value)
+			}
+			return b, nil
+		}
+	default:
+		return nil, fmt.Errorf("cannot coerce to %s", dataType)
+	}
+}
+
+// ParseDataType converts a type name used on the command line to a DataType
+func ParseDataType(name string) (schema.DataType, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "string", "str":
+		return schema.String, nil
+	case "number", "num":
+		return schema.Number, nil
+	case "integer", "int":
+		return schema.Integer, nil
+	case "float":
+		return schema.Float, nil
+	case "boolean", "bool":
+		return schema.Boolean, nil
+	default:
+		return schema.String, fmt.Errorf("unknown type %q (want string, number, integer, float or boolean)", name)
+	}
+}
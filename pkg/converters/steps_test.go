@@ -0,0 +1,86 @@
+package converters
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+
+	"github.com/loveucifer/aomi/pkg/schema"
+)
+
+func TestParseFilter(t *testing.T) {
+	// Every filter tests the field v
+	tests := []struct {
+		expr  string
+		value interface{}
+		want  bool
+	}{
+		{"v=1234567890123456789", int64(1234567890123456789), true},
+		{"v=1234567890123456789", int64(1234567890123456788), false},
+		{"v>1234567890123456788", int64(1234567890123456789), true},
+		{"v=12345678901234567890", json.Number("12345678901234567890"), true},
+		{"v=12345678901234567890", json.Number("12345678901234567891"), false},
+		{"v<12345678901234567891", json.Number("12345678901234567890"), true},
+		{"v=1234567890123456789", "1234567890123456788", false},
+		{"v=19.9", json.Number("19.90"), true},
+		{"v>19.899", json.Number("19.90"), true},
+		{"v=19.9", 19.9, true},
+		{"v<20", 19.9, true},
+		{"v=1e3", int64(1000), true},
+		{"v>=30", "n/a", false},
+		{"v!=30", "n/a", true},
+		{"v>=30", nil, false},
+		{"v=nan", int64(5), false},
+		{"v=NYC", "NYC", true},
+		{"v>M", "NYC", true},
+		{"v!=done", "open", true},
+	}
+
+	for _, tt := range tests {
+		keep, err := ParseFilter(tt.expr)
+		if err != nil {
+			t.Fatalf("ParseFilter(%q): %v", tt.expr, err)
+		}
+		if got := keep(map[string]interface{}{"v": tt.value}); got != tt.want {
+			t.Errorf("%s with v=%#v = %v, want %v", tt.expr, tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestCoerceValue(t *testing.T) {
+	tests := []struct {
+		value    interface{}
+		dataType schema.DataType
+		want     interface{}
+		wantErr  bool
+	}{
+		{value: 42.0, dataType: schema.Integer, want: int64(42)},
+		{value: -9223372036854775808.0, dataType: schema.Integer, want: int64(math.MinInt64)},
+		{value: 9223372036854775808.0, dataType: schema.Integer, wantErr: true},
+		{value: 1e300, dataType: schema.Integer, wantErr: true},
+		{value: math.Inf(-1), dataType: schema.Integer, wantErr: true},
+		{value: 1.5, dataType: schema.Integer, wantErr: true},
+		{value: json.Number("12345678901234567890"), dataType: schema.Integer, want: json.Number("12345678901234567890")},
+		{value: "42", dataType: schema.Integer, want: int64(42)},
+		{value: json.Number("19.90"), dataType: schema.Float, want: json.Number("19.90")},
+		{value: int64(7), dataType: schema.String, want: "7"},
+		{value: "yes", dataType: schema.Boolean, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := coerceValue(tt.value, tt.dataType)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("coerceValue(%v, %s) = %#v, want an error", tt.value, tt.dataType, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("coerceValue(%v, %s): %v", tt.value, tt.dataType, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("coerceValue(%v, %s) = %#v, want %#v", tt.value, tt.dataType, got, tt.want)
+		}
+	}
+}
@@ -3,11 +3,15 @@
 package detector
 
 import (
+	"bytes"
+	"sort"
 	"strings"
-	"unicode"
+	"sync"
 )
 
-// Format represents a supported data format
+// Format represents a supported data format. Formats get consecutive
+// values in the order they are registered with Register; the built-in
+// ones, registered first by package formats, have the constants below.
 type Format int
 
 const (
@@ -16,163 +20,196 @@ const (
 	YAML
 	XML
 	TOML
-	Unknown
+	NDJSON
 )
 
-// String returns the string representation of a format
-func (f Format) String() string {
-	switch f {
-	case JSON:
-		return "json"
-	case CSV:
-		return "csv"
-	case YAML:
-		return "yaml"
-	case XML:
-		return "xml"
-	case TOML:
-		return "toml"
-	default:
-		return "unknown"
-	}
-}
+// Unknown is returned when no format matches
+const Unknown Format = -1
 
-// Detector identifies the format of input data
-type Detector struct {
-	matchers []FormatMatcher
+// detection is how a registered format is recognized
+type detection struct {
+	name    string
+	matcher FormatMatcher
+	trial   TrialParser
+	prefix  FormatMatcher // scores an incomplete input; matcher if nil
 }
 
-// FormatMatcher defines a function that detects a specific format
-type FormatMatcher func([]byte) bool
+var (
+	registryMu sync.RWMutex
+	registry   []detection // indexed by Format
+)
 
-// NewDetector creates a new format detector
-func NewDetector() *Detector {
-	return &Detector{
-		matchers: []FormatMatcher{
-			isJSON,
-			isCSV,
-			isYAML,
-			isXML,
-			isTOML,
-		},
+// Register adds a format to detection and returns its value. prefix scores
+// the beginning of inputs too large to read whole (matcher if nil), and
+// trial confirms close calls by parsing. Registering an existing name
+// replaces the functions that are set. A format without a matcher is
+// known by name but never detected.
+func Register(name string, matcher, prefix FormatMatcher, trial TrialParser) Format {
+	name = strings.ToLower(name)
+
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	for i := range registry {
+		if registry[i].name == name {
+			if matcher != nil {
+				registry[i].matcher = matcher
+			}
+			if prefix != nil {
+				registry[i].prefix = prefix
+			}
+			if trial != nil {
+				registry[i].trial = trial
+			}
+			return Format(i)
+		}
 	}
+
+	registry = append(registry, detection{name: name, matcher: matcher, prefix: prefix, trial: trial})
+	return Format(len(registry) - 1)
 }
 
-// DetectFormat detects the format of the input data
-func (d *Detector) DetectFormat(data []byte) Format {
-	for i, matcher := range d.matchers {
-		if matcher(data) {
+// Lookup returns the format registered under name, or Unknown
+func Lookup(name string) Format {
+	name = strings.ToLower(name)
+
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	for i, d := range registry {
+		if d.name == name {
 			return Format(i)
 		}
 	}
 	return Unknown
 }
 
-// isJSON checks if the data is in JSON format
-func isJSON(data []byte) bool {
-	s := string(data)
-	s = strings.TrimSpace(s)
+// String returns the string representation of a format
+func (f Format) String() string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
 
-	if len(s) == 0 {
-		return false
+	if f < 0 || int(f) >= len(registry) {
+		return "unknown"
 	}
+	return registry[f].name
+}
+
+// DefaultTieMargin is how close to the best score a candidate must be for
+// its format to be trial-parsed
+const DefaultTieMargin = 0.3
+
+// Detector identifies the format of input data
+type Detector struct {
+	formats []detection // indexed by Format
 
-	// Check if it starts with { or [ and ends with } or ]
-	return (s[0] == '{' && s[len(s)-1] == '}') ||
-		(s[0] == '[' && s[len(s)-1] == ']')
+	// TieMargin: candidates scoring within this distance of the best one
+	// are trial-parsed, and those that parse are ranked first
+	TieMargin float64
 }
 
-// isCSV checks if the data is in CSV format
-func isCSV(data []byte) bool {
-	s := string(data)
-	lines := strings.Split(s, "\n")
+// FormatMatcher scores how much data looks like a format, from 0 (not at
+// all) to 1 (certainly)
+type FormatMatcher func([]byte) float64
 
-	if len(lines) == 0 {
-		return false
-	}
+// TrialParser fully parses data, returning an error if it isn't valid
+type TrialParser func([]byte) error
 
-	// Look for comma-separated values pattern
-	for _, line := range lines {
-		if strings.Contains(line, ",") && len(strings.TrimSpace(line)) > 0 {
-			// Check if it looks like CSV (comparable fields)
-			fields := strings.Split(line, ",")
-			if len(fields) >= 2 { // At least 2 fields to be considered CSV
-				return true
-			}
-		}
+// Candidate is a possible format of the input with its score
+type Candidate struct {
+	Format     Format
+	Confidence float64
+
+	// Tried is set when the candidate was trial-parsed; Err holds the
+	// parse error, if any
+	Tried bool
+	Err   error
+}
+
+// NewDetector creates a format detector for every registered format
+func NewDetector() *Detector {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	return &Detector{
+		formats:   append([]detection{}, registry...),
+		TieMargin: DefaultTieMargin,
 	}
-	return false
 }
 
-// isYAML checks if the data is in YAML format
-func isYAML(data []byte) bool {
-	s := string(data)
-	lines := strings.Split(s, "\n")
-
-	for _, line := range lines {
-		line = strings.TrimSpace(line)
-		if len(line) > 0 && !strings.HasPrefix(line, "#") { // Skip comments
-			// Look for YAML key: value pattern
-			if strings.Contains(line, ": ") || strings.HasPrefix(line, "- ") {
-				return true
-			}
-			// Look for indentation in YAML
-			if strings.HasPrefix(line, "  ") || strings.HasPrefix(line, "\t") {
-				return true
-			}
-		}
+// DetectFormat detects the format of the input data
+func (d *Detector) DetectFormat(data []byte) Format {
+	candidates := d.DetectWithConfidence(data)
+	if len(candidates) == 0 {
+		return Unknown
 	}
-	return false
+	return candidates[0].Format
 }
 
-// isXML checks if the data is in XML format
-func isXML(data []byte) bool {
-	s := string(data)
-	s = strings.TrimSpace(s)
+// DetectWithConfidence returns every format the data could be in, best
+// first. Candidates close to the best score are trial-parsed: those that
+// parse rank above those that don't, otherwise higher scores come first.
+func (d *Detector) DetectWithConfidence(data []byte) []Candidate {
+	var candidates []Candidate
+	for i, f := range d.formats {
+		if f.matcher == nil {
+			continue
+		}
+		if score := f.matcher(data); score > 0 {
+			candidates = append(candidates, Candidate{Format: Format(i), Confidence: score})
+		}
+	}
+	if len(candidates) == 0 {
+		return nil
+	}
 
-	if len(s) < 5 {
-		return false
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].Confidence > candidates[j].Confidence
+	})
+
+	// Break ties by parsing with the real parsers :0
+	best := candidates[0].Confidence
+	tied := 0
+	for tied < len(candidates) && best-candidates[tied].Confidence <= d.TieMargin {
+		c := &candidates[tied]
+		if trial := d.formats[c.Format].trial; trial != nil {
+			c.Tried = true
+			c.Err = trial(data)
+		}
+		tied++
 	}
 
-	// Check if it starts with XML declaration or tag
-	return strings.HasPrefix(s, "<?xml") ||
-		strings.HasPrefix(s, "<") ||
-		strings.Contains(s, "</")
+	sort.SliceStable(candidates[:tied], func(i, j int) bool {
+		return candidates[i].Err == nil && candidates[j].Err != nil
+	})
+
+	return candidates
 }
 
-// isTOML checks if the data is in TOML format
-func isTOML(data []byte) bool {
-	s := string(data)
-	lines := strings.Split(s, "\n")
-
-	for _, line := range lines {
-		line = strings.TrimSpace(line)
-		// Skip empty lines and comments
-		if len(line) > 0 && !strings.HasPrefix(line, "#") {
-			// Look for TOML key = value pattern or table headers
-			if strings.Contains(line, "=") && !strings.Contains(line, ":") {
-				parts := strings.SplitN(line, "=", 2)
-				if len(parts) == 2 {
-					key := strings.TrimSpace(parts[0])
-					// Valid TOML key should not contain special characters
-					isValidKey := true
-					for _, r := range key {
-						if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_' && r != '-' {
-							isValidKey = false
-							break
-						}
-					}
-					if isValidKey {
-						return true
-					}
-				}
-			}
-			// Check for TOML table headers [table]
-			if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
-				return true
-			}
+// DetectPrefix ranks the formats of an input from its beginning only, for
+// inputs too large to read whole. The prefix is cut at its last line break
+// and, being incomplete, isn't trial-parsed.
+func (d *Detector) DetectPrefix(prefix []byte) []Candidate {
+	if i := bytes.LastIndexByte(prefix, '\n'); i >= 0 {
+		prefix = prefix[:i+1]
+	}
+
+	var candidates []Candidate
+	for i, f := range d.formats {
+		matcher := f.prefix
+		if matcher == nil {
+			matcher = f.matcher
+		}
+		if matcher == nil {
+			continue
+		}
+		if score := matcher(prefix); score > 0 {
+			candidates = append(candidates, Candidate{Format: Format(i), Confidence: score})
 		}
 	}
-	return false
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].Confidence > candidates[j].Confidence
+	})
+	return candidates
 }
-// Final implementation
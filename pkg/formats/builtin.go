@@ -0,0 +1,74 @@
+// Package formats is the registry of data formats Aomi reads and writes
+// Built-in formats, registered on import :)
+package formats
+
+import (
+	"github.com/loveucifer/aomi/pkg/parsers"
+	"github.com/loveucifer/aomi/pkg/writers"
+)
+
+// Built-in formats
+var JSON, CSV, YAML, XML, TOML, NDJSON *Format
+
+// The built-in formats are registered first, in the order of the
+// detector's constants (detector.JSON, detector.CSV, ...)
+func init() {
+	JSON = MustRegister(Format{
+		Name:          "json",
+		Extensions:    []string{"json"},
+		MIMEType:      "application/json",
+		Matcher:       scoreJSON,
+		PrefixMatcher: scoreJSONPrefix,
+		NewParser:     func() Parser { return &parsers.JSONParser{} },
+		NewWriter:     func() Writer { return &writers.JSONWriter{} },
+	})
+
+	CSV = MustRegister(Format{
+		Name:       "csv",
+		Extensions: []string{"csv"},
+		MIMEType:   "text/csv",
+		Matcher:    scoreCSV,
+		NewParser:  func() Parser { return parsers.NewCSVParser() },
+		NewWriter:  func() Writer { return &writers.CSVWriter{} },
+	})
+
+	YAML = MustRegister(Format{
+		Name:       "yaml",
+		Aliases:    []string{"yml"},
+		Extensions: []string{"yaml", "yml"},
+		MIMEType:   "application/yaml",
+		Matcher:    scoreYAML,
+		Trial:      trialYAML,
+		NewParser:  func() Parser { return &parsers.YAMLParser{} },
+		NewWriter:  func() Writer { return &writers.YAMLWriter{} },
+		Streams:    true,
+	})
+
+	XML = MustRegister(Format{
+		Name:       "xml",
+		Extensions: []string{"xml"},
+		MIMEType:   "application/xml",
+		Matcher:    scoreXML,
+		NewParser:  func() Parser { return parsers.NewXMLParser() },
+		NewWriter:  func() Writer { return &writers.XMLWriter{} },
+	})
+
+	TOML = MustRegister(Format{
+		Name:       "toml",
+		Extensions: []string{"toml"},
+		MIMEType:   "application/toml",
+		Matcher:    scoreTOML,
+		NewParser:  func() Parser { return &parsers.TOMLParser{} },
+		NewWriter:  func() Writer { return &writers.TOMLWriter{} },
+	})
+
+	NDJSON = MustRegister(Format{
+		Name:       "ndjson",
+		Aliases:    []string{"jsonl"},
+		Extensions: []string{"ndjson", "jsonl"},
+		MIMEType:   "application/x-ndjson",
+		Matcher:    scoreNDJSON,
+		NewParser:  func() Parser { return &parsers.NDJSONParser{} },
+		NewWriter:  func() Writer { return &writers.NDJSONWriter{} },
+	})
+}
@@ -0,0 +1,210 @@
+// Package formats is the registry of data formats Aomi reads and writes
+// One place to plug in new formats :D
+package formats
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/loveucifer/aomi/pkg/detector"
+	"github.com/loveucifer/aomi/pkg/parsers"
+	"github.com/loveucifer/aomi/pkg/schema"
+	"github.com/loveucifer/aomi/pkg/writers"
+)
+
+// Parser reads a document from a stream
+type Parser = parsers.Parser
+
+// Writer writes a document to a stream
+type Writer = writers.Writer
+
+// Format describes a registered format
+type Format struct {
+	ID         detector.Format // assigned by Register
+	Name       string
+	Aliases    []string // other names accepted by Lookup, e.g. "yml"
+	Extensions []string // file extensions without the dot; the first is used for output files
+	MIMEType   string
+
+	// Matcher scores input for auto-detection; formats without one
+	// aren't detected. PrefixMatcher scores the beginning of inputs too
+	// large to read whole (Matcher if nil). Trial confirms a close call by
+	// parsing; if nil, the data is parsed with NewParser.
+	Matcher       detector.FormatMatcher
+	PrefixMatcher detector.FormatMatcher
+	Trial         detector.TrialParser
+
+	NewParser func() Parser // nil if the format can't be read
+	NewWriter func() Writer // nil if the format can't be written
+
+	// Streams is set if the writer writes a stream document (Stream set)
+	// as separate documents, like --- separated YAML
+	Streams bool
+}
+
+// Parse parses r with a new parser for the format, so a Format is a
+// Parser itself
+func (f *Format) Parse(ctx context.Context, r io.Reader) (*schema.Document, error) {
+	if f.NewParser == nil {
+		return nil, fmt.Errorf("%s input is not supported", f.Name)
+	}
+	return f.NewParser().Parse(ctx, r)
+}
+
+// Write writes a document to out with a new writer for the format, so a
+// Format is a Writer itself
+func (f *Format) Write(ctx context.Context, out io.Writer, doc *schema.Document) error {
+	if f.NewWriter == nil {
+		return fmt.Errorf("%s output is not supported", f.Name)
+	}
+	return f.NewWriter().Write(ctx, out, doc)
+}
+
+var (
+	mu       sync.RWMutex
+	byID     = make(map[detector.Format]*Format)
+	byName   = make(map[string]*Format) // names and aliases
+	byExt    = make(map[string]*Format)
+	ordering []*Format // registration order
+)
+
+// Register adds a format to the registry and to format detection. Names,
+// aliases and extensions are case-insensitive and must not be taken by
+// another format.
+func Register(f Format) (*Format, error) {
+	f.Name = strings.ToLower(strings.TrimSpace(f.Name))
+	if f.Name == "" {
+		return nil, fmt.Errorf("formats: format has no name")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	names := append([]string{f.Name}, f.Aliases...)
+	for i, name := range names {
+		names[i] = strings.ToLower(name)
+		if other, ok := byName[names[i]]; ok {
+			return nil, fmt.Errorf("formats: name %q is already used by %s", name, other.Name)
+		}
+	}
+	exts := make([]string, len(f.Extensions))
+	for i, ext := range f.Extensions {
+		exts[i] = normalizeExt(ext)
+		if other, ok := byExt[exts[i]]; ok {
+			return nil, fmt.Errorf("formats: extension %q is already used by %s", ext, other.Name)
+		}
+	}
+
+	// Formats that can be parsed are confirmed by trial-parsing
+	trial := f.Trial
+	if trial == nil && f.Matcher != nil && f.NewParser != nil {
+		newParser := f.NewParser
+		trial = func(data []byte) error {
+			_, err := parsers.ParseBytes(newParser(), data)
+			return err
+		}
+	}
+
+	registered := f
+	registered.ID = detector.Register(f.Name, f.Matcher, f.PrefixMatcher, trial)
+	registered.Aliases = names[1:]
+	registered.Extensions = exts
+
+	byID[registered.ID] = &registered
+	for _, name := range names {
+		byName[name] = &registered
+	}
+	for _, ext := range exts {
+		byExt[ext] = &registered
+	}
+	ordering = append(ordering, &registered)
+
+	return &registered, nil
+}
+
+// MustRegister is like Register but panics on error, for use in init
+func MustRegister(f Format) *Format {
+	registered, err := Register(f)
+	if err != nil {
+		panic(err)
+	}
+	return registered
+}
+
+// Lookup finds a format by name, alias or extension, or returns nil
+func Lookup(name string) *Format {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	key := strings.ToLower(strings.TrimSpace(name))
+	if f, ok := byName[key]; ok {
+		return f
+	}
+	return byExt[normalizeExt(key)]
+}
+
+// ByID returns the registered format with the detector value id, or nil
+func ByID(id detector.Format) *Format {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	return byID[id]
+}
+
+// ForPath returns the format of a file path by its extension, or nil
+func ForPath(path string) *Format {
+	ext := filepath.Ext(path)
+	if ext == "" {
+		return nil
+	}
+
+	mu.RLock()
+	defer mu.RUnlock()
+
+	return byExt[normalizeExt(ext)]
+}
+
+// Detect detects the format of data among the registered formats, or
+// returns nil
+func Detect(data []byte) *Format {
+	return ByID(detector.NewDetector().DetectFormat(data))
+}
+
+// DetectPrefix detects the format from the beginning of a larger input,
+// or returns nil
+func DetectPrefix(prefix []byte) *Format {
+	candidates := detector.NewDetector().DetectPrefix(prefix)
+	if len(candidates) == 0 {
+		return nil
+	}
+	return ByID(candidates[0].Format)
+}
+
+// All returns the registered formats in registration order
+func All() []*Format {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	return append([]*Format{}, ordering...)
+}
+
+// Names returns the names of all registered formats in registration order
+func Names() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	names := make([]string, 0, len(ordering))
+	for _, f := range ordering {
+		names = append(names, f.Name)
+	}
+	return names
+}
+
+// normalizeExt lowercases an extension and strips its dot
+func normalizeExt(ext string) string {
+	return strings.TrimPrefix(strings.ToLower(strings.TrimSpace(ext)), ".")
+}
@@ -0,0 +1,265 @@
+// Package formats is the registry of data formats Aomi reads and writes
+// Matchers that recognize the built-in formats :D
+package formats
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/loveucifer/aomi/pkg/parsers"
+)
+
+// significantLines returns the lines that aren't blank or # comments
+func significantLines(data []byte) []string {
+	var lines []string
+	for _, line := range strings.Split(string(data), "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		lines = append(lines, strings.TrimRight(line, "\r"))
+	}
+	return lines
+}
+
+// scoreJSON scores data wrapped in {} or []
+func scoreJSON(data []byte) float64 {
+	s := strings.TrimSpace(string(data))
+	if len(s) < 2 {
+		return 0
+	}
+
+	// Check if it starts with { or [ and ends with } or ]
+	if (s[0] == '{' && s[len(s)-1] == '}') || (s[0] == '[' && s[len(s)-1] == ']') {
+		return 0.9
+	}
+	return 0
+}
+
+// scoreNDJSON scores data with one JSON object or array per line. A single
+// line is plain JSON, so it scores below JSON.
+func scoreNDJSON(data []byte) float64 {
+	lines := 0
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+		if (line[0] != '{' && line[0] != '[') || !json.Valid(line) {
+			return 0
+		}
+		lines++
+	}
+
+	switch lines {
+	case 0:
+		return 0
+	case 1:
+		return 0.5
+	default:
+		return 0.95 // :D a record per line
+	}
+}
+
+// scoreJSONPrefix scores the beginning of a JSON object or array: an
+// opening brace or bracket followed by a JSON value rather than, say, the
+// name of a TOML [table]
+func scoreJSONPrefix(data []byte) float64 {
+	s := strings.TrimSpace(string(data))
+	if strings.HasPrefix(s, "{") {
+		return 0.9
+	}
+	if !strings.HasPrefix(s, "[") {
+		return 0
+	}
+
+	s = strings.TrimLeft(s, "[ \t\r\n")
+	switch {
+	case s == "":
+		return 0.5
+	case strings.ContainsRune("{\"]-0123456789", rune(s[0])):
+		return 0.9
+	case strings.HasPrefix(s, "true") || strings.HasPrefix(s, "false") || strings.HasPrefix(s, "null"):
+		return 0.7
+	}
+	return 0
+}
+
+// scoreCSV scores data by how consistently its rows split into the same
+// number (two or more) of fields, with the sniffed delimiter and quote.
+// Rows that all start with a "key: " are more likely YAML with commas in
+// its values, so they score at most half as much.
+func scoreCSV(data []byte) float64 {
+	guess := parsers.SniffDialect(data)
+
+	switch {
+	case guess.Rows == 0 || guess.Fields < 2:
+		return 0
+	case guess.Rows == 1:
+		return 0.4 // a single row could be anything with commas
+	case allKeyed(data, guess.Delimiter):
+		return 0.4 * guess.Consistency
+	default:
+		return 0.8 * guess.Consistency
+	}
+}
+
+// allKeyed reports whether every line starts with a YAML "key:" that
+// holds no delimiter, as in "name: Smith, Ann"
+func allKeyed(data []byte, delimiter rune) bool {
+	lines := significantLines(data)
+	for _, line := range lines {
+		colon := strings.Index(line, ":")
+		if !yamlKeyLine.MatchString(line) || strings.ContainsRune(line[:colon], delimiter) {
+			return false
+		}
+	}
+	return len(lines) > 0
+}
+
+var (
+	yamlKeyLine  = regexp.MustCompile(`^\s*(- +)?[^\s#<{\[-][^:]*:(\s|$)`)
+	yamlItemLine = regexp.MustCompile(`^\s*-(\s|$)`)
+)
+
+// scoreYAML scores data by the share of lines that look like YAML:
+// "key: value", "- item", indented continuations and document markers
+func scoreYAML(data []byte) float64 {
+	lines := significantLines(data)
+	if len(lines) == 0 {
+		return 0
+	}
+
+	matching := 0
+	keys := 0
+	for _, line := range lines {
+		switch {
+		case yamlKeyLine.MatchString(line), yamlItemLine.MatchString(line):
+			keys++
+			matching++
+		case line == "---" || line == "...":
+			matching++
+		case strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t"):
+			matching++ // nested block or multi-line value
+		}
+	}
+
+	if keys == 0 {
+		return 0
+	}
+	return 0.8 * float64(matching) / float64(len(lines))
+}
+
+// scoreXML scores data that starts with a declaration or a tag
+func scoreXML(data []byte) float64 {
+	s := strings.TrimSpace(string(data))
+
+	switch {
+	case len(s) < 5:
+		return 0
+	case strings.HasPrefix(s, "<?xml"):
+		return 1
+	case strings.HasPrefix(s, "<") && strings.HasSuffix(s, ">"):
+		return 0.9
+	case strings.HasPrefix(s, "<"):
+		return 0.5
+	case strings.Contains(s, "</"):
+		return 0.2
+	}
+	return 0
+}
+
+var (
+	tomlKey        = `(?:[A-Za-z0-9_-]+|"[^"]*"|'[^']*')`
+	tomlDottedKey  = tomlKey + `(?:\s*\.\s*` + tomlKey + `)*`
+	tomlHeaderLine = regexp.MustCompile(`^\s*\[\[?\s*` + tomlDottedKey + `\s*\]\]?\s*(#.*)?$`)
+	tomlKeyLine    = regexp.MustCompile(`^\s*` + tomlDottedKey + `\s*=`)
+)
+
+// scoreTOML scores data by the share of lines that are [table] headers or
+// key = value pairs; lines continuing a multi-line array, inline table or
+// string count too
+func scoreTOML(data []byte) float64 {
+	lines := significantLines(data)
+	if len(lines) == 0 {
+		return 0
+	}
+
+	matching := 0
+	depth := 0         // open brackets of a multi-line value
+	multiline := false // inside a """ or ''' string
+	for _, line := range lines {
+		if depth > 0 || multiline {
+			matching++
+		} else if tomlHeaderLine.MatchString(line) {
+			matching++
+			continue
+		} else if tomlKeyLine.MatchString(line) {
+			matching++
+		} else {
+			continue
+		}
+
+		delta, toggles := tomlBrackets(line)
+		depth += delta
+		if depth < 0 {
+			depth = 0
+		}
+		if toggles%2 == 1 {
+			multiline = !multiline
+		}
+	}
+
+	return 0.85 * float64(matching) / float64(len(lines))
+}
+
+// tomlBrackets returns the bracket balance of a line outside strings and
+// how many multi-line string delimiters it contains
+func tomlBrackets(line string) (int, int) {
+	depth, toggles := 0, 0
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		if strings.HasPrefix(line[i:], `"""`) || strings.HasPrefix(line[i:], `'''`) {
+			toggles++
+			i += 2
+			continue
+		}
+		switch {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#':
+			return depth, toggles
+		case c == '[' || c == '{':
+			depth++
+		case c == ']' || c == '}':
+			depth--
+		}
+	}
+	return depth, toggles
+}
+
+// trialYAML trial-parses YAML. Almost any text is a valid YAML scalar, so
+// only mappings and sequences count as YAML documents.
+func trialYAML(data []byte) error {
+	doc, err := parsers.ParseBytes(&parsers.YAMLParser{}, data)
+	if err != nil {
+		return err
+	}
+
+	switch doc.Data.(type) {
+	case map[string]interface{}, []interface{}:
+		return nil
+	default:
+		return fmt.Errorf("yaml: document is a plain %T, not a mapping or sequence", doc.Data)
+	}
+}
@@ -0,0 +1,234 @@
+// Package jsonschema provides JSON Schema support for Aomi
+// Exports inferred schemas as JSON Schema (draft 2020-12) :D
+package jsonschema
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/loveucifer/aomi/pkg/schema"
+)
+
+// Draft is the JSON Schema dialect written by Generate
+const Draft = "https://json-schema.org/draft/2020-12/schema"
+
+// Schema is a JSON Schema document or subschema. Only the keywords Aomi
+// generates or validates are modeled; decoding a schema that uses another
+// validation keyword (see unsupportedKeywords) fails rather than quietly
+// accepting anything. Annotations such as title are ignored.
+type Schema struct {
+	Schema     string             `json:"$schema,omitempty"`
+	Type       TypeList           `json:"type,omitempty"`
+	Format     string             `json:"format,omitempty"`
+	Properties map[string]*Schema `json:"properties,omitempty"`
+	Required   []string           `json:"required,omitempty"`
+	Items      *Schema            `json:"items,omitempty"`
+	AnyOf      []*Schema          `json:"anyOf,omitempty"`
+
+	// Validation keywords. Numbers in Enum and Const decode as
+	// json.Number, so they compare exactly, like the bounds.
+	Enum                 []interface{} `json:"enum,omitempty"`
+	Const                interface{}   `json:"const,omitempty"`
+	HasConst             bool          `json:"-"` // const is set, possibly to null
+	Pattern              string        `json:"pattern,omitempty"`
+	MinLength            *int          `json:"minLength,omitempty"`
+	MaxLength            *int          `json:"maxLength,omitempty"`
+	Minimum              *json.Number  `json:"minimum,omitempty"`
+	Maximum              *json.Number  `json:"maximum,omitempty"`
+	ExclusiveMinimum     *json.Number  `json:"exclusiveMinimum,omitempty"`
+	ExclusiveMaximum     *json.Number  `json:"exclusiveMaximum,omitempty"`
+	MinItems             *int          `json:"minItems,omitempty"`
+	MaxItems             *int          `json:"maxItems,omitempty"`
+	AdditionalProperties *Schema       `json:"additionalProperties,omitempty"`
+	AllOf                []*Schema     `json:"allOf,omitempty"`
+	OneOf                []*Schema     `json:"oneOf,omitempty"`
+	Not                  *Schema       `json:"not,omitempty"`
+
+	// Bool is set for the boolean schemas true (anything) and false (nothing)
+	Bool *bool `json:"-"`
+}
+
+// unsupportedKeywords are the validation keywords of draft 2020-12 (and
+// earlier drafts) that Validate doesn't check; a schema using one is
+// rejected, since ignoring it would accept data the schema forbids
+var unsupportedKeywords = []string{
+	"$ref", "$defs", "definitions", "$dynamicRef", "$recursiveRef",
+	"multipleOf", "uniqueItems", "minProperties", "maxProperties",
+	"patternProperties", "propertyNames", "dependentRequired", "dependentSchemas", "dependencies",
+	"prefixItems", "additionalItems", "contains", "minContains", "maxContains",
+	"unevaluatedItems", "unevaluatedProperties", "if", "then", "else",
+}
+
+// schemaFields has Schema's fields without its JSON methods
+type schemaFields Schema
+
+// MarshalJSON writes boolean schemas as true/false
+func (s Schema) MarshalJSON() ([]byte, error) {
+	if s.Bool != nil {
+		return json.Marshal(*s.Bool)
+	}
+	if s.HasConst && s.Const == nil {
+		// omitempty would drop "const": null
+		return json.Marshal(struct {
+			schemaFields
+			Const *struct{} `json:"const"`
+		}{schemaFields: schemaFields(s)})
+	}
+	return json.Marshal(schemaFields(s))
+}
+
+// UnmarshalJSON accepts both schema objects and boolean schemas, and
+// rejects schemas using keywords Validate can't check
+func (s *Schema) UnmarshalJSON(data []byte) error {
+	var b bool
+	if err := json.Unmarshal(data, &b); err == nil {
+		*s = Schema{Bool: &b}
+		return nil
+	}
+
+	var keywords map[string]json.RawMessage
+	if err := json.Unmarshal(data, &keywords); err != nil {
+		return err
+	}
+	for _, keyword := range unsupportedKeywords {
+		if _, ok := keywords[keyword]; ok {
+			return fmt.Errorf("jsonschema: keyword %q is not supported", keyword)
+		}
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode((*schemaFields)(s)); err != nil {
+		return err
+	}
+	_, s.HasConst = keywords["const"]
+	return nil
+}
+
+// TypeList holds the "type" keyword, which is a string or a list of strings
+type TypeList []string
+
+// MarshalJSON writes a single type as a plain string
+func (t TypeList) MarshalJSON() ([]byte, error) {
+	if len(t) == 1 {
+		return json.Marshal(t[0])
+	}
+	return json.Marshal([]string(t))
+}
+
+// UnmarshalJSON accepts both "string" and ["string", "null"]
+func (t *TypeList) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*t = TypeList{single}
+		return nil
+	}
+
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+	*t = list
+	return nil
+}
+
+// Generate converts an inferred schema into a JSON Schema document
+func Generate(s *schema.Schema) *Schema {
+	out := fromSchema(s)
+	if out == nil {
+		out = &Schema{}
+	}
+	out.Schema = Draft
+	return out
+}
+
+// fromSchema converts a schema node, returning nil for "anything"
+func fromSchema(s *schema.Schema) *Schema {
+	if s == nil {
+		return nil
+	}
+
+	switch s.Type {
+	case schema.Object:
+		out := &Schema{Type: TypeList{"object"}, Properties: make(map[string]*Schema)}
+		for name, field := range s.Fields {
+			out.Properties[name] = fromField(field)
+			if field.Required {
+				out.Required = append(out.Required, name)
+			}
+		}
+		sort.Strings(out.Required)
+		return out
+	case schema.Array:
+		out := &Schema{Type: TypeList{"array"}}
+		if s.Items != nil {
+			out.Items = fromField(s.Items)
+		}
+		return out
+	case schema.Union:
+		out := &Schema{}
+		for _, member := range s.Members {
+			out.AnyOf = append(out.AnyOf, fromSchema(member))
+		}
+		return simplifyAnyOf(out)
+	default:
+		typeName, format := scalarType(s.Type)
+		return &Schema{Type: TypeList{typeName}, Format: format}
+	}
+}
+
+// fromField converts a field, allowing null when it was seen
+func fromField(field *schema.FieldSchema) *Schema {
+	nested := field.Nested
+	if nested == nil {
+		nested = &schema.Schema{Type: field.Type}
+	}
+
+	out := fromSchema(nested)
+	if !field.Nullable || nested.Type == schema.Null {
+		return out
+	}
+
+	if len(out.Type) > 0 {
+		out.Type = append(out.Type, "null")
+		return out
+	}
+	out.AnyOf = append(out.AnyOf, &Schema{Type: TypeList{"null"}})
+	return out
+}
+
+// simplifyAnyOf turns an anyOf of plain types into a type list
+func simplifyAnyOf(s *Schema) *Schema {
+	var types TypeList
+	for _, member := range s.AnyOf {
+		if len(member.Type) != 1 || member.Format != "" || member.Properties != nil || member.Items != nil || member.AnyOf != nil {
+			return s
+		}
+		types = append(types, member.Type[0])
+	}
+	return &Schema{Type: types}
+}
+
+// scalarType maps a scalar data type to a JSON Schema type and format
+func scalarType(t schema.DataType) (string, string) {
+	switch t {
+	case schema.Integer:
+		return "integer", ""
+	case schema.Number, schema.Float:
+		return "number", ""
+	case schema.Boolean:
+		return "boolean", ""
+	case schema.Null:
+		return "null", ""
+	case schema.DateTime:
+		return "string", "date-time"
+	case schema.Date:
+		return "string", "date"
+	case schema.Time:
+		return "string", "time"
+	default:
+		return "string", ""
+	}
+}
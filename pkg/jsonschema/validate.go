@@ -0,0 +1,388 @@
+// Package jsonschema provides JSON Schema support for Aomi
+// Validates parsed documents against a JSON Schema :0
+package jsonschema
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/loveucifer/aomi/pkg/schema"
+)
+
+// ValidationError is a single schema violation
+type ValidationError struct {
+	Path    string // JSON Pointer to the offending value ("" is the root)
+	Message string
+}
+
+// Error formats the violation with its path
+func (e ValidationError) Error() string {
+	path := e.Path
+	if path == "" {
+		path = "(root)"
+	}
+	return path + ": " + e.Message
+}
+
+// Validate checks data against the schema and returns every violation
+func (s *Schema) Validate(data interface{}) []ValidationError {
+	v := &validator{patterns: make(map[string]*regexp.Regexp)}
+	v.validate(s, data, "")
+	return v.errors
+}
+
+// validator collects violations while walking the data
+type validator struct {
+	errors   []ValidationError
+	patterns map[string]*regexp.Regexp
+}
+
+func (v *validator) fail(path, format string, args ...interface{}) {
+	v.errors = append(v.errors, ValidationError{Path: path, Message: fmt.Sprintf(format, args...)})
+}
+
+// validate checks a single value against a (sub)schema
+func (v *validator) validate(s *Schema, value interface{}, path string) {
+	if s == nil {
+		return
+	}
+	if s.Bool != nil {
+		if !*s.Bool {
+			v.fail(path, "no value is allowed here")
+		}
+		return
+	}
+
+	if len(s.Type) > 0 && !matchesAnyType(value, s.Type) {
+		v.fail(path, "expected %s, got %s", strings.Join(s.Type, " or "), typeName(value))
+		return // the remaining keywords would only repeat the mismatch
+	}
+
+	if len(s.Enum) > 0 {
+		found := false
+		for _, allowed := range s.Enum {
+			if equalValues(value, allowed) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			v.fail(path, "value %v is not one of %v", displayValue(value), s.Enum)
+		}
+	}
+	if (s.HasConst || s.Const != nil) && !equalValues(value, s.Const) {
+		v.fail(path, "value %v must be %v", displayValue(value), displayValue(s.Const))
+	}
+
+	if str, ok := stringValue(value); ok {
+		v.validateString(s, str, path)
+	}
+	if _, ok := numberValue(value); ok {
+		v.validateNumber(s, value, path)
+	}
+
+	switch val := value.(type) {
+	case []interface{}:
+		v.validateArray(s, val, path)
+	case map[string]interface{}:
+		v.validateObject(s, val, path)
+	}
+
+	v.validateCombinators(s, value, path)
+}
+
+func (v *validator) validateString(s *Schema, str, path string) {
+	length := utf8.RuneCountInString(str)
+	if s.MinLength != nil && length < *s.MinLength {
+		v.fail(path, "string is shorter than %d characters", *s.MinLength)
+	}
+	if s.MaxLength != nil && length > *s.MaxLength {
+		v.fail(path, "string is longer than %d characters", *s.MaxLength)
+	}
+	if s.Pattern != "" {
+		re, ok := v.patterns[s.Pattern]
+		if !ok {
+			var err error
+			if re, err = regexp.Compile(s.Pattern); err != nil {
+				v.fail(path, "invalid pattern %q in schema: %v", s.Pattern, err)
+				return
+			}
+			v.patterns[s.Pattern] = re
+		}
+		if !re.MatchString(str) {
+			v.fail(path, "%q does not match pattern %q", str, s.Pattern)
+		}
+	}
+}
+
+func (v *validator) validateNumber(s *Schema, num interface{}, path string) {
+	// cmp is 0 for bounds that aren't numbers, which pass
+	cmp := func(bound *json.Number) int {
+		c, _ := compareNumbers(num, *bound)
+		return c
+	}
+	if s.Minimum != nil && cmp(s.Minimum) < 0 {
+		v.fail(path, "%v is less than the minimum %v", num, *s.Minimum)
+	}
+	if s.Maximum != nil && cmp(s.Maximum) > 0 {
+		v.fail(path, "%v is greater than the maximum %v", num, *s.Maximum)
+	}
+	if s.ExclusiveMinimum != nil && cmp(s.ExclusiveMinimum) <= 0 {
+		v.fail(path, "%v must be greater than %v", num, *s.ExclusiveMinimum)
+	}
+	if s.ExclusiveMaximum != nil && cmp(s.ExclusiveMaximum) >= 0 {
+		v.fail(path, "%v must be less than %v", num, *s.ExclusiveMaximum)
+	}
+}
+
+func (v *validator) validateArray(s *Schema, arr []interface{}, path string) {
+	if s.MinItems != nil && len(arr) < *s.MinItems {
+		v.fail(path, "array has fewer than %d items", *s.MinItems)
+	}
+	if s.MaxItems != nil && len(arr) > *s.MaxItems {
+		v.fail(path, "array has more than %d items", *s.MaxItems)
+	}
+	if s.Items != nil {
+		for i, item := range arr {
+			v.validate(s.Items, item, path+"/"+strconv.Itoa(i))
+		}
+	}
+}
+
+func (v *validator) validateObject(s *Schema, obj map[string]interface{}, path string) {
+	for _, name := range s.Required {
+		if _, ok := obj[name]; !ok {
+			v.fail(path, "missing required property %q", name)
+		}
+	}
+
+	keys := make([]string, 0, len(obj))
+	for key := range obj {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		childPath := path + "/" + escapePointer(key)
+		if prop, ok := s.Properties[key]; ok {
+			v.validate(prop, obj[key], childPath)
+			continue
+		}
+		if s.AdditionalProperties != nil {
+			if s.AdditionalProperties.Bool != nil && !*s.AdditionalProperties.Bool {
+				v.fail(childPath, "additional property %q is not allowed", key)
+				continue
+			}
+			v.validate(s.AdditionalProperties, obj[key], childPath)
+		}
+	}
+}
+
+func (v *validator) validateCombinators(s *Schema, value interface{}, path string) {
+	for _, sub := range s.AllOf {
+		v.validate(sub, value, path)
+	}
+
+	if len(s.AnyOf) > 0 && countMatches(s.AnyOf, value) == 0 {
+		v.fail(path, "value does not match any of the allowed schemas (anyOf)")
+	}
+	if len(s.OneOf) > 0 {
+		if n := countMatches(s.OneOf, value); n != 1 {
+			v.fail(path, "value matches %d schemas, exactly one is required (oneOf)", n)
+		}
+	}
+	if s.Not != nil && countMatches([]*Schema{s.Not}, value) == 1 {
+		v.fail(path, "value must not match the schema in \"not\"")
+	}
+}
+
+// countMatches returns how many schemas accept the value
+func countMatches(schemas []*Schema, value interface{}) int {
+	n := 0
+	for _, sub := range schemas {
+		if len(sub.Validate(value)) == 0 {
+			n++
+		}
+	}
+	return n
+}
+
+// matchesAnyType reports whether the value has one of the JSON types
+func matchesAnyType(value interface{}, types []string) bool {
+	for _, t := range types {
+		if matchesType(value, t) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchesType(value interface{}, t string) bool {
+	switch t {
+	case "integer":
+		if exact, ok := exactNumber(value); ok {
+			return exact.IsInt()
+		}
+		num, ok := numberValue(value)
+		return ok && num == math.Trunc(num)
+	case "number":
+		_, ok := numberValue(value)
+		return ok
+	case "string":
+		_, ok := stringValue(value)
+		return ok
+	default:
+		return typeName(value) == t
+	}
+}
+
+// typeName returns the JSON type of a document value
+func typeName(value interface{}) string {
+	if _, ok := numberValue(value); ok {
+		return "number"
+	}
+	if _, ok := stringValue(value); ok {
+		return "string"
+	}
+
+	switch value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	default:
+		return fmt.Sprintf("%T", value)
+	}
+}
+
+// numberValue returns the value as float64 if it is any kind of number
+func numberValue(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case float32:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	case json.Number:
+		// Beyond float64 (1e400) it is still a number, as ±Inf
+		f, err := strconv.ParseFloat(v.String(), 64)
+		return f, err == nil || errors.Is(err, strconv.ErrRange)
+	default:
+		return 0, false
+	}
+}
+
+// maxExactExponent bounds the exponents of numbers compared exactly; a
+// rational of 1e1000000000 would take gigabytes
+const maxExactExponent = 1000
+
+// exactNumber returns an integer or json.Number as an exact rational.
+// Floats aren't exact: 0.1 would be compared as the binary float it is.
+func exactNumber(value interface{}) (*big.Rat, bool) {
+	switch v := value.(type) {
+	case int:
+		return new(big.Rat).SetInt64(int64(v)), true
+	case int64:
+		return new(big.Rat).SetInt64(v), true
+	case uint64:
+		return new(big.Rat).SetUint64(v), true
+	case json.Number:
+		text := v.String()
+		if i := strings.IndexAny(text, "eE"); i >= 0 {
+			exp, err := strconv.Atoi(text[i+1:])
+			if err != nil || exp > maxExactExponent || exp < -maxExactExponent {
+				return nil, false
+			}
+		}
+		return new(big.Rat).SetString(text)
+	default:
+		return nil, false
+	}
+}
+
+// compareNumbers compares two numbers, exactly unless one of them is a
+// float. ok is false if either isn't a number.
+func compareNumbers(a, b interface{}) (cmp int, ok bool) {
+	if x, ok := exactNumber(a); ok {
+		if y, ok := exactNumber(b); ok {
+			return x.Cmp(y), true
+		}
+	}
+
+	x, okA := numberValue(a)
+	y, okB := numberValue(b)
+	if !okA || !okB || math.IsNaN(x) || math.IsNaN(y) {
+		return 0, false
+	}
+	switch {
+	case x < y:
+		return -1, true
+	case x > y:
+		return 1, true
+	}
+	return 0, true
+}
+
+// stringValue returns the value as a string if it is a string in JSON,
+// which includes dates and times
+func stringValue(value interface{}) (string, bool) {
+	switch v := value.(type) {
+	case string:
+		return v, true
+	case time.Time:
+		return v.Format(time.RFC3339Nano), true
+	case schema.LocalDate, schema.LocalTime, schema.LocalDateTime:
+		return fmt.Sprintf("%v", v), true
+	default:
+		return "", false
+	}
+}
+
+// equalValues compares document values the way JSON does: numbers by
+// value, dates as their text
+func equalValues(a, b interface{}) bool {
+	if _, ok := numberValue(a); ok {
+		cmp, ok := compareNumbers(a, b)
+		return ok && cmp == 0
+	}
+	if x, ok := stringValue(a); ok {
+		y, ok := stringValue(b)
+		return ok && x == y
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// displayValue formats a value for messages
+func displayValue(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return strconv.Quote(v)
+	case nil:
+		return "null"
+	}
+	return fmt.Sprintf("%v", value)
+}
+
+// escapePointer escapes a key for use in a JSON Pointer
+func escapePointer(key string) string {
+	return strings.NewReplacer("~", "~0", "/", "~1").Replace(key)
+}
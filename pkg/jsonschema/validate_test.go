@@ -0,0 +1,202 @@
+package jsonschema
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/loveucifer/aomi/pkg/schema"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		schema string
+		data   interface{}
+		want   []string // violations, as Error() prints them
+	}{
+		{
+			name:   "valid object",
+			schema: `{"type":"object","required":["name"],"properties":{"name":{"type":"string"},"age":{"type":"integer","minimum":0}}}`,
+			data:   map[string]interface{}{"name": "Ann", "age": int64(30)},
+		},
+		{
+			name:   "type mismatch stops at the value",
+			schema: `{"properties":{"age":{"type":"integer","minimum":0}}}`,
+			data:   map[string]interface{}{"age": "old"},
+			want:   []string{"/age: expected integer, got string"},
+		},
+		{
+			name:   "missing required property",
+			schema: `{"required":["name","email"]}`,
+			data:   map[string]interface{}{"name": "Ann"},
+			want:   []string{`(root): missing required property "email"`},
+		},
+		{
+			name:   "number bounds",
+			schema: `{"items":{"minimum":1,"maximum":150,"exclusiveMaximum":100}}`,
+			data:   []interface{}{int64(0), int64(50), int64(200)},
+			want: []string{
+				"/0: 0 is less than the minimum 1",
+				"/2: 200 is greater than the maximum 150",
+				"/2: 200 must be less than 100",
+			},
+		},
+		{
+			name:   "json.Number and float values are numbers",
+			schema: `{"items":{"type":"integer"}}`,
+			data:   []interface{}{json.Number("12345678901234567890"), 2.0, json.Number("1.5")},
+			want:   []string{"/2: expected integer, got number"},
+		},
+		{
+			name:   "exact bounds for exact numbers",
+			schema: `{"items":{"maximum":9007199254740993,"exclusiveMinimum":19.9}}`,
+			data:   []interface{}{int64(9007199254740993), int64(9007199254740994), json.Number("19.90"), json.Number("19.900000000000001")},
+			want: []string{
+				"/1: 9007199254740994 is greater than the maximum 9007199254740993",
+				"/2: 19.90 must be greater than 19.9",
+			},
+		},
+		{
+			name:   "floats compare as floats",
+			schema: `{"items":{"minimum":0.1,"maximum":0.3}}`,
+			data:   []interface{}{0.1, 0.3},
+		},
+		{
+			name:   "integers beyond 64 bits and huge exponents",
+			schema: `{"items":{"type":"integer"}}`,
+			data:   []interface{}{json.Number("123456789012345678901234567890"), json.Number("1.0"), json.Number("1e400"), json.Number("10000000000000000.5")},
+			want:   []string{"/3: expected integer, got number"},
+		},
+		{
+			name:   "string length and pattern",
+			schema: `{"type":"string","minLength":2,"maxLength":3,"pattern":"^[a-z]+$"}`,
+			data:   "ABCD",
+			want: []string{
+				"(root): string is longer than 3 characters",
+				`(root): "ABCD" does not match pattern "^[a-z]+$"`,
+			},
+		},
+		{
+			name:   "dates are strings",
+			schema: `{"items":{"type":"string","pattern":"^1979-"}}`,
+			data: []interface{}{
+				time.Date(1979, 5, 27, 7, 32, 0, 0, time.UTC),
+				schema.LocalDate{Year: 1979, Month: 5, Day: 27},
+				schema.LocalDateTime{LocalDate: schema.LocalDate{Year: 1979, Month: 5, Day: 27}},
+			},
+		},
+		{
+			name:   "enum and const mismatches",
+			schema: `{"properties":{"a":{"enum":[1,2]},"b":{"const":"x"}}}`,
+			data:   map[string]interface{}{"a": int64(3), "b": "y"},
+			want: []string{
+				"/a: value 3 is not one of [1 2]",
+				`/b: value "y" must be "x"`,
+			},
+		},
+		{
+			name:   "enum compares exact numbers exactly",
+			schema: `{"items":{"enum":[12345678901234567890]}}`,
+			data:   []interface{}{json.Number("12345678901234567890"), json.Number("12345678901234567891")},
+			want:   []string{"/1: value 12345678901234567891 is not one of [12345678901234567890]"},
+		},
+		{
+			name:   "const null",
+			schema: `{"properties":{"a":{"const":null}}}`,
+			data:   map[string]interface{}{"a": int64(0)},
+			want:   []string{"/a: value 0 must be null"},
+		},
+		{
+			name:   "enum matches other number types",
+			schema: `{"items":{"enum":[1,2.5]}}`,
+			data:   []interface{}{int64(1), json.Number("2.50"), 1.0},
+		},
+		{
+			name:   "additional properties",
+			schema: `{"properties":{"a":{}},"additionalProperties":false}`,
+			data:   map[string]interface{}{"a": int64(1), "b/c": int64(2)},
+			want:   []string{`/b~1c: additional property "b/c" is not allowed`},
+		},
+		{
+			name:   "array length",
+			schema: `{"minItems":2,"maxItems":3}`,
+			data:   []interface{}{"x"},
+			want:   []string{"(root): array has fewer than 2 items"},
+		},
+		{
+			name:   "combinators",
+			schema: `{"anyOf":[{"type":"string"},{"type":"null"}],"oneOf":[{"type":"integer"},{"minimum":0}],"not":{"const":5}}`,
+			data:   int64(5),
+			want: []string{
+				"(root): value does not match any of the allowed schemas (anyOf)",
+				"(root): value matches 2 schemas, exactly one is required (oneOf)",
+				`(root): value must not match the schema in "not"`,
+			},
+		},
+		{
+			name:   "boolean schemas",
+			schema: `{"properties":{"a":true,"b":false}}`,
+			data:   map[string]interface{}{"a": int64(1), "b": int64(2)},
+			want:   []string{"/b: no value is allowed here"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var s Schema
+			if err := json.Unmarshal([]byte(tt.schema), &s); err != nil {
+				t.Fatalf("parsing schema: %v", err)
+			}
+
+			var got []string
+			for _, violation := range s.Validate(tt.data) {
+				got = append(got, violation.Error())
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Validate() =\n%q\nwant\n%q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUnsupportedKeywords(t *testing.T) {
+	tests := []string{
+		`{"$ref":"#/$defs/a","$defs":{"a":{}}}`,
+		`{"type":"number","multipleOf":2}`,
+		`{"uniqueItems":true}`,
+		`{"minProperties":1}`,
+		`{"patternProperties":{"^x":{}}}`,
+		`{"prefixItems":[{}]}`,
+		`{"dependentRequired":{"a":["b"]}}`,
+		`{"properties":{"a":{"items":{"$ref":"#"}}}}`,
+	}
+
+	for _, schemaText := range tests {
+		var s Schema
+		if err := json.Unmarshal([]byte(schemaText), &s); err == nil {
+			t.Errorf("Unmarshal(%s) succeeded, want an unsupported keyword error", schemaText)
+		}
+	}
+
+	// Annotations don't change what is valid
+	var s Schema
+	if err := json.Unmarshal([]byte(`{"title":"x","description":"y","$id":"z","examples":[1]}`), &s); err != nil {
+		t.Errorf("Unmarshal with annotations: %v", err)
+	}
+}
+
+func TestConstNullRoundTrip(t *testing.T) {
+	var s Schema
+	if err := json.Unmarshal([]byte(`{"const":null}`), &s); err != nil {
+		t.Fatal(err)
+	}
+	data, err := json.Marshal(&s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `{"const":null}` {
+		t.Errorf("Marshal() = %s, want {\"const\":null}", data)
+	}
+}
@@ -3,128 +3,225 @@
 package parsers
 
 import (
-	"encoding/csv"
-	"github.com/loveucifer/aomi/pkg/schema"
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
 	"strconv"
-	"strings"
+	"unicode/utf8"
+
+	"github.com/loveucifer/aomi/pkg/schema"
+)
+
+// HeaderMode says whether the first CSV row holds the column names
+type HeaderMode int
+
+const (
+	// HeaderAuto sniffs the header row from the input
+	HeaderAuto HeaderMode = iota
+	// HeaderPresent takes the column names from the first row
+	HeaderPresent
+	// HeaderAbsent reads every row as data, naming columns field_0, field_1...
+	HeaderAbsent
 )
 
-// CSVParser parses CSV data into the internal document model
+// CSVParser parses CSV data into the internal document model. Dialect
+// settings left at zero are sniffed from the start of the input.
 type CSVParser struct {
-	Delimiter rune
-	HasHeader bool
+	Delimiter rune // 0 = sniffed
+	Quote     rune // 0 = sniffed; any ASCII character
+	Header    HeaderMode
+
+	Types       TypeInference              // How untyped cells are read (default SafeTypes)
+	ColumnTypes map[string]schema.DataType // Per-column types, by header, overriding Types
 }
 
-// NewCSVParser creates a new CSV parser with default settings
+// NewCSVParser creates a new CSV parser that sniffs the dialect
 func NewCSVParser() *CSVParser {
-	return &CSVParser{
-		Delimiter: ',',
-		HasHeader: true,
-	}
+	return &CSVParser{}
 }
 
-// Parse parses CSV data into a Document
-func (p *CSVParser) Parse(data []byte) (*schema.Document, error) {
-	reader := csv.NewReader(strings.NewReader(string(data)))
-	reader.Comma = rune(p.Delimiter)
-
-	records, err := reader.ReadAll()
+// Parse reads CSV from r into a Document
+func (p *CSVParser) Parse(ctx context.Context, r io.Reader) (*schema.Document, error) {
+	records, err := p.newRecordReader(&contextReader{ctx: ctx, r: r})
 	if err != nil {
 		return nil, err // :0 parsing failed
 	}
 
-	if len(records) == 0 {
+	if records.headers == nil {
 		return &schema.Document{
 			Schema: &schema.Schema{Type: schema.Array},
 			Data:   []interface{}{},
 		}, nil
 	}
 
-	// Determine headers
-	var headers []string
-	if p.HasHeader && len(records) > 0 {
-		headers = records[0]
-		records = records[1:] // Skip header row
-	} else {
-		// Generate generic headers
-		if len(records) > 0 {
-			for i := 0; i < len(records[0]); i++ {
-				headers = append(headers, "field_"+strconv.Itoa(i))
-			}
-		}
-	}
-
 	// Convert records to array of objects
 	var result []interface{}
-	for _, record := range records {
-		row := make(map[string]interface{})
-		for i, value := range record {
-			if i < len(headers) {
-				// Try to infer data type
-				row[headers[i]] = inferType(value) // :D smart type detection
-			}
+	for {
+		row, _, err := records.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err // :0 parsing failed
 		}
 		result = append(result, row)
 	}
 
 	// Create schema for the CSV data
-	schemaObj := p.inferCSVSchema(headers, result)
+	schemaObj := p.inferCSVSchema(records.headers, result)
 
 	doc := &schema.Document{
 		Schema: schemaObj,
 		Data:   result,
+		Order:  &schema.KeyOrder{Items: records.order},
 	}
 
 	return doc, nil // :) success
 }
 
-// inferType tries to infer the data type from string value
-func inferType(value string) interface{} {
-	// Try to parse as boolean
-	switch strings.ToLower(strings.TrimSpace(value)) {
-	case "true", "1", "yes", "on":
-		return true
-	case "false", "0", "no", "off":
-		return false
+// CanStream reports true: CSV is always a stream of rows
+func (p *CSVParser) CanStream(prefix []byte) bool {
+	return true
+}
+
+// Records reads CSV rows one at a time as records
+func (p *CSVParser) Records(ctx context.Context, r io.Reader) (RecordReader, error) {
+	return p.newRecordReader(&contextReader{ctx: ctx, r: r})
+}
+
+// csvRecordReader turns CSV rows into records keyed by the headers
+type csvRecordReader struct {
+	parser  *CSVParser
+	reader  *dialectReader
+	headers []string // nil for empty input
+	order   *schema.KeyOrder
+	pending []string // first row when there is no header row
+}
+
+// newRecordReader settles the dialect and reads the header row (or
+// generates headers from the width of the first row)
+func (p *CSVParser) newRecordReader(r io.Reader) (*csvRecordReader, error) {
+	dialect, r, err := p.dialect(r)
+	if err != nil {
+		return nil, err
 	}
+	reader := dialect.newReader(r)
 
-	// Try to parse as number
-	if num, err := strconv.ParseFloat(value, 64); err == nil {
-		return num
+	records := &csvRecordReader{parser: p, reader: reader}
+	first, err := reader.Read()
+	if err == io.EOF {
+		return records, nil
+	}
+	if err != nil {
+		return nil, err
 	}
 
-	// Default to string
-	return value
+	// Determine headers
+	if dialect.HasHeader {
+		records.headers = append([]string{}, first...)
+	} else {
+		// Generate generic headers
+		for i := range first {
+			records.headers = append(records.headers, "field_"+strconv.Itoa(i))
+		}
+		records.pending = first
+	}
+	records.order = schema.NewKeyOrder(records.headers...)
+	return records, nil
+}
+
+// dialect returns the parser's dialect, sniffing the settings left at zero
+// from the start of r. The returned reader still yields all of r.
+func (p *CSVParser) dialect(r io.Reader) (Dialect, io.Reader, error) {
+	dialect := Dialect{
+		Delimiter: p.Delimiter,
+		Quote:     p.Quote,
+		HasHeader: p.Header != HeaderAbsent,
+	}
+
+	if p.Delimiter == 0 || p.Quote == 0 || p.Header == HeaderAuto {
+		buffered := bufio.NewReaderSize(r, sniffSize)
+		sample, err := buffered.Peek(sniffSize)
+		if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+			return dialect, nil, err
+		}
+		r = buffered
+		if err == nil { // more input follows: drop the partial last row
+			if i := bytes.LastIndexByte(sample, '\n'); i >= 0 {
+				sample = sample[:i+1]
+			}
+		}
+
+		sniffed := SniffDialect(sample)
+		if p.Delimiter == 0 {
+			dialect.Delimiter = sniffed.Delimiter
+		}
+		if p.Quote == 0 {
+			dialect.Quote = sniffed.Quote
+		}
+		if p.Header == HeaderAuto {
+			dialect.HasHeader = sniffed.HasHeader
+		}
+	}
+
+	switch {
+	case dialect.Quote >= utf8.RuneSelf:
+		return dialect, nil, fmt.Errorf("csv: quote %q is not an ASCII character", dialect.Quote)
+	case dialect.Quote == dialect.Delimiter:
+		return dialect, nil, fmt.Errorf("csv: quote and delimiter are both %q", dialect.Quote)
+	}
+	return dialect, r, nil
+}
+
+func (c *csvRecordReader) Next() (interface{}, *schema.KeyOrder, error) {
+	record := c.pending
+	c.pending = nil
+	if record == nil {
+		if c.headers == nil {
+			return nil, nil, io.EOF
+		}
+		var err error
+		if record, err = c.reader.Read(); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	row := make(map[string]interface{}, len(c.headers))
+	for i, cell := range record {
+		if i >= len(c.headers) {
+			break
+		}
+		value, err := c.parser.cellValue(c.headers[i], cell) // :D smart type detection
+		if err != nil {
+			line, column := c.reader.FieldPos(i)
+			return nil, nil, fmt.Errorf("csv: line %d, column %d (%s): %v", line, column, c.headers[i], err)
+		}
+		row[c.headers[i]] = value
+	}
+	return row, c.order, nil
 }
 
-// inferCSVSchema infers schema from CSV headers and sample data
+// inferCSVSchema infers schema from CSV headers and all rows. Empty cells
+// count as missing, so columns with gaps become optional.
 func (p *CSVParser) inferCSVSchema(headers []string, data []interface{}) *schema.Schema {
 	// For CSV, we typically have an array of objects
 	arraySchema := &schema.Schema{Type: schema.Array}
 
-	if len(data) > 0 {
-		// Use the first record to determine schema
-		if first, ok := data[0].(map[string]interface{}); ok {
-			fields := make(map[string]*schema.FieldSchema)
-
-			for _, header := range headers {
-				if value, exists := first[header]; exists {
-					dataType := inferSchema(value).Type
-					fields[header] = &schema.FieldSchema{
-						Name:     header,
-						Type:     dataType,
-						Required: true,
-						Nested:   inferSchema(value),
-					}
-				}
-			}
+	for _, row := range data {
+		record, ok := row.(map[string]interface{})
+		if !ok {
+			continue
+		}
 
-			arraySchema.Items = &schema.FieldSchema{
-				Name:   "record",
-				Type:   schema.Object,
-				Nested: &schema.Schema{Type: schema.Object, Fields: fields},
+		present := make(map[string]interface{}, len(headers))
+		for _, header := range headers {
+			if value, exists := record[header]; exists && value != "" {
+				present[header] = value
 			}
 		}
+		arraySchema.Items = mergeFields(arraySchema.Items, InferOptions{}.field("record", present))
 	}
 
 	return arraySchema
@@ -0,0 +1,149 @@
+// Package parsers provides format-specific parsing for Aomi
+// CSV cell typing: how much to read into a string :0
+package parsers
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/loveucifer/aomi/pkg/schema"
+)
+
+// TypeInference decides how CSV cells become values
+type TypeInference int
+
+const (
+	// SafeTypes converts only unambiguous literals: true and false, and
+	// plain decimal numbers without leading zeros or exponents, keeping
+	// their exact digits. "01234", "1e5", "yes" and " 1" stay strings.
+	SafeTypes TypeInference = iota
+	// NoTypes keeps every cell as a string
+	NoTypes
+	// AggressiveTypes converts anything that parses: 1/0, yes/no and on/off
+	// as booleans, and any number strconv accepts (leading zeros and
+	// exponents included)
+	AggressiveTypes
+)
+
+// Literals SafeTypes converts
+var (
+	safeInteger = regexp.MustCompile(`^(0|-?[1-9][0-9]*)$`)
+	safeFloat   = regexp.MustCompile(`^-?(0|[1-9][0-9]*)\.[0-9]+$`)
+)
+
+// ParseTypeInference parses a mode name: none, safe or aggressive
+func ParseTypeInference(name string) (TypeInference, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "safe", "":
+		return SafeTypes, nil
+	case "none", "string", "strings":
+		return NoTypes, nil
+	case "aggressive":
+		return AggressiveTypes, nil
+	default:
+		return SafeTypes, fmt.Errorf("unknown type inference %q (want none, safe or aggressive)", name)
+	}
+}
+
+// cellValue turns a cell of a column into a value, using the column's
+// type if it has one and the inference mode otherwise
+func (p *CSVParser) cellValue(column, cell string) (interface{}, error) {
+	if dataType, ok := p.ColumnTypes[column]; ok {
+		return typedCell(cell, dataType)
+	}
+
+	switch p.Types {
+	case NoTypes:
+		return cell, nil
+	case AggressiveTypes:
+		return inferType(cell), nil
+	default:
+		return safeType(cell), nil
+	}
+}
+
+// safeType converts strict literals and keeps everything else as is
+func safeType(value string) interface{} {
+	switch value {
+	case "true":
+		return true
+	case "false":
+		return false
+	}
+
+	// Numbers keep every digit: beyond int64 and for decimals such as
+	// amounts, the exact text is kept as a json.Number
+	if safeInteger.MatchString(value) || safeFloat.MatchString(value) {
+		return exactNumber(value)
+	}
+
+	return value
+}
+
+// inferType tries to infer the data type from string value
+func inferType(value string) interface{} {
+	// Try to parse as boolean
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "true", "1", "yes", "on":
+		return true
+	case "false", "0", "no", "off":
+		return false
+	}
+
+	// Try to parse as number, keeping whole numbers as integers
+	if num, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return num
+	}
+	if num, err := strconv.ParseFloat(value, 64); err == nil {
+		return num
+	}
+
+	// Default to string
+	return value
+}
+
+// typedCell converts a cell to an explicit column type. Empty cells stay
+// empty; anything else that doesn't convert is an error.
+func typedCell(cell string, dataType schema.DataType) (interface{}, error) {
+	value := strings.TrimSpace(cell)
+	if value == "" || dataType == schema.String {
+		return cell, nil
+	}
+
+	switch dataType {
+	case schema.Integer:
+		if safeInteger.MatchString(value) {
+			return exactNumber(value), nil
+		}
+		if num, err := strconv.ParseInt(value, 10, 64); err == nil {
+			return num, nil
+		}
+	case schema.Float, schema.Number:
+		if jsonNumberPattern.MatchString(value) {
+			if dataType == schema.Float {
+				if !strings.ContainsAny(value, ".eE") {
+					value += ".0" // a whole number is still a float
+				}
+				return json.Number(value), nil
+			}
+			return exactNumber(value), nil
+		}
+		if num, err := strconv.ParseFloat(value, 64); err == nil {
+			return num, nil
+		}
+	case schema.Boolean:
+		switch strings.ToLower(value) {
+		case "true", "1", "yes", "on", "y", "t":
+			return true, nil
+		case "false", "0", "no", "off", "n", "f":
+			return false, nil
+		}
+	default:
+		return nil, fmt.Errorf("unsupported column type %s", dataType)
+	}
+
+	return nil, fmt.Errorf("cannot read %q as %s", cell, dataType)
+}
@@ -0,0 +1,72 @@
+package parsers
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/loveucifer/aomi/pkg/schema"
+)
+
+func TestSafeType(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		want  interface{}
+	}{
+		{"zip code keeps its leading zero", "01234", "01234"},
+		{"exponent ID stays text", "1e5", "1e5"},
+		{"yes stays text", "yes", "yes"},
+		{"one stays a number, not a boolean", "1", int64(1)},
+		{"padded number stays text", " 1", " 1"},
+		{"booleans", "true", true},
+		{"int64", "-42", int64(-42)},
+		{"integer beyond 64 bits", "12345678901234567890", json.Number("12345678901234567890")},
+		{"amount keeps its digits", "19.90", json.Number("19.90")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := safeType(tt.value); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("safeType(%q) = %#v, want %#v", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTypedCell(t *testing.T) {
+	tests := []struct {
+		name     string
+		cell     string
+		dataType schema.DataType
+		want     interface{}
+		wantErr  bool
+	}{
+		{name: "whole float", cell: "5", dataType: schema.Float, want: json.Number("5.0")},
+		{name: "float keeps its digits", cell: "19.90", dataType: schema.Float, want: json.Number("19.90")},
+		{name: "integer", cell: " 7 ", dataType: schema.Integer, want: int64(7)},
+		{name: "integer beyond 64 bits", cell: "12345678901234567890", dataType: schema.Integer, want: json.Number("12345678901234567890")},
+		{name: "string keeps a zip code", cell: "01234", dataType: schema.String, want: "01234"},
+		{name: "boolean yes", cell: "yes", dataType: schema.Boolean, want: true},
+		{name: "empty cell stays empty", cell: "", dataType: schema.Integer, want: ""},
+		{name: "not an integer", cell: "1.5", dataType: schema.Integer, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := typedCell(tt.cell, tt.dataType)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("typedCell(%q) = %#v, want an error", tt.cell, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("typedCell(%q): %v", tt.cell, err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("typedCell(%q) = %#v, want %#v", tt.cell, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,242 @@
+// Package parsers provides format-specific parsing for Aomi
+// CSV dialect sniffing: delimiter, quote and header row :0
+package parsers
+
+import (
+	"bytes"
+	"encoding/csv"
+	"io"
+)
+
+// Dialect describes how a CSV file is written
+type Dialect struct {
+	Delimiter rune // ',', ';', '\t' or '|' when sniffed
+	Quote     rune // '"' or '\'' when sniffed
+	HasHeader bool
+}
+
+// DefaultDialect is comma-separated with double quotes and a header row
+var DefaultDialect = Dialect{Delimiter: ',', Quote: '"', HasHeader: true}
+
+// DialectGuess is a sniffed dialect with how well the sample fits it
+type DialectGuess struct {
+	Dialect
+	Rows        int     // rows read from the sample
+	Fields      int     // fields in the first row
+	Consistency float64 // share of rows with Fields fields
+}
+
+// Candidates tried by SniffDialect, in order of preference
+var (
+	sniffDelimiters = []rune{',', ';', '\t', '|'}
+	sniffQuotes     = []rune{'"', '\''}
+)
+
+// sniffSize is how much input the CSV parser sniffs
+const sniffSize = 64 << 10
+
+// SniffDialect guesses the dialect of CSV data from a sample of whole rows.
+// The delimiter and quote that split the rows most consistently into the
+// most fields win; the header row is guessed by comparing the first row
+// with the rest.
+func SniffDialect(sample []byte) DialectGuess {
+	best := DialectGuess{Dialect: DefaultDialect}
+	var bestRows [][]string
+	bestQuotes := -1
+	for _, delimiter := range sniffDelimiters {
+		for _, quote := range sniffQuotes {
+			dialect := Dialect{Delimiter: delimiter, Quote: quote}
+			rows := sniffRows(sample, dialect)
+			guess := fitDialect(dialect, rows)
+			quotes := quotedFields(sample, delimiter, quote)
+
+			if bestRows == nil || betterGuess(guess, quotes, best, bestQuotes) {
+				best, bestRows, bestQuotes = guess, rows, quotes
+			}
+		}
+	}
+
+	if best.Fields < 2 {
+		return DialectGuess{Dialect: DefaultDialect, Rows: best.Rows, Fields: best.Fields}
+	}
+	best.HasHeader = sniffHeader(bestRows)
+	return best // :D
+}
+
+// betterGuess reports whether a beats b: more consistent, then fewer read
+// errors, then more fields, then more fields wrapped in its quote
+func betterGuess(a DialectGuess, aQuotes int, b DialectGuess, bQuotes int) bool {
+	switch {
+	case a.Fields >= 2 && b.Fields < 2:
+		return true
+	case a.Fields < 2:
+		return false
+	case a.Consistency != b.Consistency:
+		return a.Consistency > b.Consistency
+	case a.Rows != b.Rows:
+		return a.Rows > b.Rows
+	case a.Fields != b.Fields:
+		return a.Fields > b.Fields
+	default:
+		return aQuotes > bQuotes
+	}
+}
+
+// fitDialect measures how consistently rows split into fields
+func fitDialect(dialect Dialect, rows [][]string) DialectGuess {
+	guess := DialectGuess{Dialect: dialect, Rows: len(rows)}
+	if len(rows) == 0 {
+		return guess
+	}
+
+	guess.Fields = len(rows[0])
+	matching := 0
+	for _, row := range rows {
+		if len(row) == guess.Fields {
+			matching++
+		}
+	}
+	guess.Consistency = float64(matching) / float64(len(rows))
+	return guess
+}
+
+// sniffRows reads rows leniently until the end of the sample or the first
+// error
+func sniffRows(sample []byte, dialect Dialect) [][]string {
+	reader := dialect.newReader(bytes.NewReader(sample))
+	reader.csv.FieldsPerRecord = -1
+	reader.csv.LazyQuotes = true
+
+	var rows [][]string
+	for {
+		row, err := reader.Read()
+		if err != nil {
+			return rows
+		}
+		rows = append(rows, row)
+	}
+}
+
+// quotedFields counts quote characters opening a field: at the start of a
+// line or right after a delimiter
+func quotedFields(sample []byte, delimiter, quote rune) int {
+	count := 0
+	previous := byte('\n')
+	for _, b := range sample {
+		if rune(b) == quote && (previous == '\n' || rune(previous) == delimiter) {
+			count++
+		}
+		previous = b
+	}
+	return count
+}
+
+// sniffHeader votes column by column on whether the first row is a header.
+// A text cell above a column of numbers is strong evidence for a header, a
+// number above numbers strong evidence against; a cell whose length differs
+// from a column of same-length values is weak evidence for. A text column
+// never votes against, as short names above short values are common, so
+// only typed columns can drop the header, which most CSV files have.
+func sniffHeader(rows [][]string) bool {
+	if len(rows) < 2 {
+		return true
+	}
+
+	votes := 0
+	for column, first := range rows[0] {
+		var cells []string
+		for _, row := range rows[1:] {
+			if column < len(row) && row[column] != "" {
+				cells = append(cells, row[column])
+			}
+		}
+		if len(cells) == 0 || first == "" {
+			continue
+		}
+
+		typed, length := true, len(cells[0])
+		for _, cell := range cells {
+			if _, isString := safeType(cell).(string); isString {
+				typed = false
+			}
+			if len(cell) != length {
+				length = -1
+			}
+		}
+
+		switch _, firstIsString := safeType(first).(string); {
+		case typed && firstIsString:
+			votes += 2
+		case typed:
+			votes -= 2
+		case length >= 0 && len(first) != length:
+			votes++
+		}
+	}
+	return votes >= 0
+}
+
+// dialectReader reads records in a dialect. encoding/csv only knows double
+// quotes, so another quote character is swapped with '"' on the way in and
+// back in each field.
+type dialectReader struct {
+	csv  *csv.Reader
+	swap byte // the quote character when it isn't '"'
+}
+
+// newReader creates a reader for the dialect
+func (d Dialect) newReader(r io.Reader) *dialectReader {
+	reader := &dialectReader{}
+	if d.Quote != 0 && d.Quote != '"' {
+		reader.swap = byte(d.Quote)
+		r = &swapReader{r: r, a: reader.swap, b: '"'}
+	}
+
+	reader.csv = csv.NewReader(r)
+	if d.Delimiter != 0 {
+		reader.csv.Comma = d.Delimiter
+	}
+	return reader
+}
+
+// Read reads the next record
+func (d *dialectReader) Read() ([]string, error) {
+	record, err := d.csv.Read()
+	if err != nil || d.swap == 0 {
+		return record, err
+	}
+	for i, field := range record {
+		record[i] = string(swapBytes([]byte(field), d.swap, '"'))
+	}
+	return record, nil
+}
+
+// FieldPos returns the line and column of a field of the last record
+func (d *dialectReader) FieldPos(field int) (line, column int) {
+	return d.csv.FieldPos(field)
+}
+
+// swapReader exchanges two bytes in everything read through it
+type swapReader struct {
+	r    io.Reader
+	a, b byte
+}
+
+func (s *swapReader) Read(p []byte) (int, error) {
+	n, err := s.r.Read(p)
+	swapBytes(p[:n], s.a, s.b)
+	return n, err
+}
+
+// swapBytes exchanges a and b in data in place
+func swapBytes(data []byte, a, b byte) []byte {
+	for i, c := range data {
+		switch c {
+		case a:
+			data[i] = b
+		case b:
+			data[i] = a
+		}
+	}
+	return data
+}
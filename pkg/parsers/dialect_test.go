@@ -0,0 +1,124 @@
+package parsers
+
+import "testing"
+
+func TestSniffDialect(t *testing.T) {
+	tests := []struct {
+		name   string
+		sample string
+		want   Dialect
+		fields int
+	}{
+		{
+			name:   "comma",
+			sample: "name,age\nAnn,30\nBob,41\n",
+			want:   Dialect{Delimiter: ',', Quote: '"', HasHeader: true},
+			fields: 2,
+		},
+		{
+			name:   "semicolon with decimal commas",
+			sample: "name;price\nTea;1,50\nCake;3,20\n",
+			want:   Dialect{Delimiter: ';', Quote: '"', HasHeader: true},
+			fields: 2,
+		},
+		{
+			name:   "tab",
+			sample: "a\tb\tc\n1\t2\t3\n",
+			want:   Dialect{Delimiter: '\t', Quote: '"', HasHeader: true},
+			fields: 3,
+		},
+		{
+			name:   "pipe",
+			sample: "id|name\n1|Ann\n2|Bob\n",
+			want:   Dialect{Delimiter: '|', Quote: '"', HasHeader: true},
+			fields: 2,
+		},
+		{
+			name:   "single quotes around delimiters",
+			sample: "name,city\n'Smith, Ann','Paris'\n'Doe, Bob','Rome'\n",
+			want:   Dialect{Delimiter: ',', Quote: '\'', HasHeader: true},
+			fields: 2,
+		},
+		{
+			name:   "no header over numbers",
+			sample: "1,2\n3,4\n5,6\n",
+			want:   Dialect{Delimiter: ',', Quote: '"', HasHeader: false},
+			fields: 2,
+		},
+		{
+			name:   "single column falls back to the default",
+			sample: "name\nAnn\nBob\n",
+			want:   DefaultDialect,
+			fields: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := SniffDialect([]byte(tt.sample))
+			if got.Dialect != tt.want {
+				t.Errorf("SniffDialect() = %+v, want %+v", got.Dialect, tt.want)
+			}
+			if got.Fields != tt.fields {
+				t.Errorf("Fields = %d, want %d", got.Fields, tt.fields)
+			}
+		})
+	}
+}
+
+func TestSniffHeader(t *testing.T) {
+	tests := []struct {
+		name string
+		rows [][]string
+		want bool
+	}{
+		{
+			name: "text above numbers",
+			rows: [][]string{{"name", "age"}, {"Ann", "30"}, {"Bob", "41"}},
+			want: true,
+		},
+		{
+			name: "numbers above numbers",
+			rows: [][]string{{"1", "2"}, {"3", "4"}},
+			want: false,
+		},
+		{
+			name: "text of the same length as the values",
+			rows: [][]string{{"name", "city"}, {"Anna", "Pari"}, {"Bobb", "Lond"}},
+			want: true,
+		},
+		{
+			name: "text of a different length than the values",
+			rows: [][]string{{"code", "country"}, {"FR", "France"}, {"DE", "Spain"}},
+			want: true,
+		},
+		{
+			name: "booleans above booleans",
+			rows: [][]string{{"true", "x"}, {"false", "y"}},
+			want: false,
+		},
+		{
+			name: "typed column outvotes a text column",
+			rows: [][]string{{"7", "a"}, {"8", "bb"}, {"9", "cc"}},
+			want: false,
+		},
+		{
+			name: "a single row is a header",
+			rows: [][]string{{"1", "2"}},
+			want: true,
+		},
+		{
+			name: "empty cells don't vote",
+			rows: [][]string{{"id", ""}, {"1", ""}, {"2", "x"}},
+			want: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sniffHeader(tt.rows); got != tt.want {
+				t.Errorf("sniffHeader(%q) = %v, want %v", tt.rows, got, tt.want)
+			}
+		})
+	}
+}
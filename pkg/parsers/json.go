@@ -3,66 +3,158 @@
 package parsers
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
+	"fmt"
+	"io"
+
 	"github.com/loveucifer/aomi/pkg/schema"
 )
 
 // JSONParser parses JSON data into the internal document model
 type JSONParser struct{}
 
-// Parse parses JSON data into a Document
-func (p *JSONParser) Parse(data []byte) (*schema.Document, error) {
-	var raw interface{}
-	if err := json.Unmarshal(data, &raw); err != nil {
+// Parse reads JSON from r into a Document
+func (p *JSONParser) Parse(ctx context.Context, r io.Reader) (*schema.Document, error) {
+	decoder := newJSONDecoder(&contextReader{ctx: ctx, r: r})
+	order := schema.NewKeyOrder()
+
+	raw, err := decodeJSONValue(decoder, order)
+	if err != nil {
 		return nil, err // :0 parsing failed
 	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return nil, fmt.Errorf("json: unexpected data after top-level value")
+	}
 
 	// Create schema based on the JSON structure
 	schemaObj := inferSchema(raw) // :D auto-detect structure
 	doc := &schema.Document{
 		Schema: schemaObj,
 		Data:   raw,
+		Order:  order,
 	}
 
 	return doc, nil // :) success
 }
 
-// inferSchema infers the schema from the raw data
-func inferSchema(data interface{}) *schema.Schema {
-	switch v := data.(type) {
-	case string:
-		return &schema.Schema{Type: schema.String}
-	case float64: // JSON numbers are float64
-		return &schema.Schema{Type: schema.Number}
-	case bool:
-		return &schema.Schema{Type: schema.Boolean}
-	case []interface{}:
-		// Array - get schema of first element as representative
-		s := &schema.Schema{Type: schema.Array}
-		if len(v) > 0 {
-			s.Items = &schema.FieldSchema{
-				Name:   "item",
-				Type:   inferSchema(v[0]).Type,
-				Nested: inferSchema(v[0]),
+// CanStream reports whether the input is a top-level array
+func (p *JSONParser) CanStream(prefix []byte) bool {
+	trimmed := bytes.TrimLeft(prefix, " \t\r\n")
+	return len(trimmed) > 0 && trimmed[0] == '['
+}
+
+// Records reads the elements of a top-level JSON array one at a time
+func (p *JSONParser) Records(ctx context.Context, r io.Reader) (RecordReader, error) {
+	decoder := newJSONDecoder(&contextReader{ctx: ctx, r: r})
+	token, err := decoder.Token()
+	if err != nil {
+		return nil, err
+	}
+	if delim, ok := token.(json.Delim); !ok || delim != '[' {
+		return nil, fmt.Errorf("json: top-level value is not an array")
+	}
+	return &jsonArrayReader{decoder: decoder}, nil
+}
+
+// jsonArrayReader decodes array elements token by token
+type jsonArrayReader struct {
+	decoder *json.Decoder
+	done    bool
+}
+
+func (j *jsonArrayReader) Next() (interface{}, *schema.KeyOrder, error) {
+	if j.done {
+		return nil, nil, io.EOF
+	}
+
+	if !j.decoder.More() {
+		j.done = true
+		if _, err := j.decoder.Token(); err != nil { // closing ]
+			return nil, nil, err
+		}
+		if _, err := j.decoder.Token(); err != io.EOF {
+			return nil, nil, fmt.Errorf("json: unexpected data after top-level value")
+		}
+		return nil, nil, io.EOF
+	}
+
+	order := schema.NewKeyOrder()
+	value, err := decodeJSONValue(j.decoder, order)
+	if err != nil {
+		return nil, nil, err
+	}
+	return value, order, nil
+}
+
+// newJSONDecoder creates a decoder that keeps numbers as json.Number, so
+// they are read exactly
+func newJSONDecoder(r io.Reader) *json.Decoder {
+	decoder := json.NewDecoder(r)
+	decoder.UseNumber()
+	return decoder
+}
+
+// decodeJSONValue decodes the next value token by token, recording the
+// order of object keys as they appear in the input
+func decodeJSONValue(decoder *json.Decoder, order *schema.KeyOrder) (interface{}, error) {
+	token, err := decoder.Token()
+	if err != nil {
+		if err == io.EOF {
+			return nil, io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+
+	if num, ok := token.(json.Number); ok {
+		return exactNumber(num.String()), nil // int64, or the exact text
+	}
+	delim, ok := token.(json.Delim)
+	if !ok {
+		return token, nil // string, bool or nil
+	}
+
+	switch delim {
+	case '{':
+		obj := make(map[string]interface{})
+		for decoder.More() {
+			keyToken, err := decoder.Token()
+			if err != nil {
+				return nil, err
 			}
+			key, ok := keyToken.(string)
+			if !ok {
+				return nil, fmt.Errorf("json: object key must be a string, got %v", keyToken)
+			}
+
+			value, err := decodeJSONValue(decoder, order.AddKey(key))
+			if err != nil {
+				return nil, err
+			}
+			obj[key] = value
+		}
+		if _, err := decoder.Token(); err != nil { // closing }
+			return nil, err
 		}
-		return s
-	case map[string]interface{}:
-		// Object - create field schema for each key
-		fields := make(map[string]*schema.FieldSchema)
-		for key, value := range v {
-			fields[key] = &schema.FieldSchema{
-				Name:     key,
-				Type:     inferSchema(value).Type,
-				Required: true,
-				Nested:   inferSchema(value),
+		return obj, nil
+	case '[':
+		arr := []interface{}{}
+		order.AddItem()
+		for decoder.More() {
+			elem := schema.NewKeyOrder()
+			value, err := decodeJSONValue(decoder, elem)
+			if err != nil {
+				return nil, err
 			}
+			arr = append(arr, value)
+			order.AddElem(elem)
 		}
-		return &schema.Schema{
-			Type:   schema.Object,
-			Fields: fields,
+		if _, err := decoder.Token(); err != nil { // closing ]
+			return nil, err
 		}
+		return arr, nil
 	default:
-		return &schema.Schema{Type: schema.String} // Default to string
+		return nil, fmt.Errorf("json: unexpected %v", delim)
 	}
 }
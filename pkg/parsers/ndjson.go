@@ -0,0 +1,103 @@
+// Package parsers provides format-specific parsing for Aomi
+// NDJSON / JSON Lines parser: one record per line :D
+package parsers
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/loveucifer/aomi/pkg/schema"
+)
+
+// NDJSONParser parses newline-delimited JSON (JSON Lines). Each non-blank
+// line is one element of the document array.
+type NDJSONParser struct{}
+
+// Parse reads NDJSON from r into a Document holding an array of records
+func (p *NDJSONParser) Parse(ctx context.Context, r io.Reader) (*schema.Document, error) {
+	reader := newNDJSONReader(&contextReader{ctx: ctx, r: r})
+	order := schema.NewKeyOrder()
+	order.AddItem()
+
+	result := []interface{}{}
+	for {
+		record, recordOrder, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err // :0 parsing failed
+		}
+		result = append(result, record)
+		order.AddElem(recordOrder)
+	}
+
+	doc := &schema.Document{
+		Schema: inferSchema(result),
+		Data:   result,
+		Order:  order,
+	}
+
+	return doc, nil // :) success
+}
+
+// CanStream reports true: NDJSON is always a stream of records
+func (p *NDJSONParser) CanStream(prefix []byte) bool {
+	return true
+}
+
+// Records reads NDJSON lines one at a time as records
+func (p *NDJSONParser) Records(ctx context.Context, r io.Reader) (RecordReader, error) {
+	return newNDJSONReader(&contextReader{ctx: ctx, r: r}), nil
+}
+
+// ndjsonReader decodes one JSON value per line
+type ndjsonReader struct {
+	reader *bufio.Reader
+	line   int
+}
+
+func newNDJSONReader(r io.Reader) *ndjsonReader {
+	return &ndjsonReader{reader: bufio.NewReader(r)}
+}
+
+func (n *ndjsonReader) Next() (interface{}, *schema.KeyOrder, error) {
+	order := schema.NewKeyOrder()
+	record, err := n.next(order)
+	if err != nil {
+		return nil, nil, err
+	}
+	return record, order, nil
+}
+
+// next decodes the next non-blank line, recording its key order in order
+func (n *ndjsonReader) next(order *schema.KeyOrder) (interface{}, error) {
+	for {
+		line, err := n.reader.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		n.line++
+
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			if err == io.EOF {
+				return nil, io.EOF
+			}
+			continue // blank lines separate nothing
+		}
+
+		decoder := newJSONDecoder(bytes.NewReader(line))
+		record, decodeErr := decodeJSONValue(decoder, order)
+		if decodeErr != nil {
+			return nil, fmt.Errorf("ndjson: line %d: %v", n.line, decodeErr)
+		}
+		if _, trailing := decoder.Token(); trailing != io.EOF {
+			return nil, fmt.Errorf("ndjson: line %d: unexpected data after value", n.line)
+		}
+		return record, nil
+	}
+}
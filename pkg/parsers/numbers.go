@@ -0,0 +1,26 @@
+// Package parsers provides format-specific parsing for Aomi
+// Exact numbers for IDs and amounts float64 would change :0
+package parsers
+
+import (
+	"encoding/json"
+	"regexp"
+	"strconv"
+)
+
+// Numbers read from JSON, YAML and CSV text are int64 when they are
+// integers that fit, and otherwise json.Number holding the exact decimal
+// text, which writers emit verbatim. Formats with typed numbers (TOML) and
+// computed values use int64 and float64.
+
+// jsonNumberPattern matches a number in JSON syntax
+var jsonNumberPattern = regexp.MustCompile(`^-?(0|[1-9][0-9]*)(\.[0-9]+)?([eE][-+]?[0-9]+)?$`)
+
+// exactNumber returns a decimal literal as int64 if it is an integer that
+// fits, and as json.Number otherwise, keeping every digit
+func exactNumber(text string) interface{} {
+	if i, err := strconv.ParseInt(text, 10, 64); err == nil {
+		return i
+	}
+	return json.Number(text)
+}
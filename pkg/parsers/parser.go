@@ -0,0 +1,50 @@
+// Package parsers provides format-specific parsing for Aomi
+// The Parser interface every format implements :)
+package parsers
+
+import (
+	"bytes"
+	"context"
+	"io"
+
+	"github.com/loveucifer/aomi/pkg/schema"
+)
+
+// Parser reads a document from a stream. Format options (delimiters,
+// attribute prefixes, ...) are fields of the implementing type.
+type Parser interface {
+	Parse(ctx context.Context, r io.Reader) (*schema.Document, error)
+}
+
+// Every built-in parser implements Parser
+var (
+	_ Parser = (*JSONParser)(nil)
+	_ Parser = (*CSVParser)(nil)
+	_ Parser = (*YAMLParser)(nil)
+	_ Parser = (*XMLParser)(nil)
+	_ Parser = (*TOMLParser)(nil)
+	_ Parser = (*NDJSONParser)(nil)
+)
+
+// ParseBytes parses in-memory data with p
+func ParseBytes(p Parser, data []byte) (*schema.Document, error) {
+	return p.Parse(context.Background(), bytes.NewReader(data))
+}
+
+// readAll reads r to the end, giving up once ctx is done
+func readAll(ctx context.Context, r io.Reader) ([]byte, error) {
+	return io.ReadAll(&contextReader{ctx: ctx, r: r})
+}
+
+// contextReader fails reads once its context is done
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (c *contextReader) Read(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return c.r.Read(p)
+}
@@ -0,0 +1,207 @@
+// Package parsers provides format-specific parsing for Aomi
+// Shared schema inference helpers :D
+package parsers
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/loveucifer/aomi/pkg/schema"
+)
+
+// InferOptions controls schema inference
+type InferOptions struct {
+	// SampleSize limits how many elements of each array are inspected
+	// and merged into the item schema. Zero inspects every element.
+	SampleSize int
+}
+
+// InferSchema infers the schema of already decoded data, the same way
+// parsers do for freshly parsed input
+func InferSchema(data interface{}) *schema.Schema {
+	return inferSchema(data)
+}
+
+// InferSchemaWithOptions infers a schema, sampling arrays as configured
+func InferSchemaWithOptions(data interface{}, opts InferOptions) *schema.Schema {
+	return opts.infer(data)
+}
+
+// MergeSchemas merges schemas inferred from separate values, such as the
+// documents of a stream, into one schema that describes each of them
+func MergeSchemas(a, b *schema.Schema) *schema.Schema {
+	return mergeSchemas(a, b)
+}
+
+// inferSchema infers the schema from the raw data
+func inferSchema(data interface{}) *schema.Schema {
+	return InferOptions{}.infer(data)
+}
+
+// infer infers the schema of a single value
+func (o InferOptions) infer(data interface{}) *schema.Schema {
+	switch v := data.(type) {
+	case nil:
+		return &schema.Schema{Type: schema.Null}
+	case string:
+		return &schema.Schema{Type: schema.String}
+	case json.Number:
+		if strings.ContainsAny(v.String(), ".eE") {
+			return &schema.Schema{Type: schema.Float}
+		}
+		return &schema.Schema{Type: schema.Integer}
+	case float64, float32:
+		return &schema.Schema{Type: schema.Float}
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return &schema.Schema{Type: schema.Integer}
+	case time.Time, schema.LocalDateTime:
+		return &schema.Schema{Type: schema.DateTime}
+	case schema.LocalDate:
+		return &schema.Schema{Type: schema.Date}
+	case schema.LocalTime:
+		return &schema.Schema{Type: schema.Time}
+	case bool:
+		return &schema.Schema{Type: schema.Boolean}
+	case []interface{}:
+		// Array - merge the schemas of all (sampled) elements
+		s := &schema.Schema{Type: schema.Array}
+		sample := v
+		if o.SampleSize > 0 && len(sample) > o.SampleSize {
+			sample = sample[:o.SampleSize]
+		}
+		for _, item := range sample {
+			s.Items = mergeFields(s.Items, o.field("item", item))
+		}
+		return s
+	case map[string]interface{}:
+		// Object - create field schema for each key
+		fields := make(map[string]*schema.FieldSchema)
+		for key, value := range v {
+			fields[key] = o.field(key, value)
+		}
+		return &schema.Schema{
+			Type:   schema.Object,
+			Fields: fields,
+		}
+	default:
+		return &schema.Schema{Type: schema.String} // Default to string
+	}
+}
+
+// field infers the schema of a value stored under name
+func (o InferOptions) field(name string, value interface{}) *schema.FieldSchema {
+	nested := o.infer(value)
+	return &schema.FieldSchema{
+		Name:     name,
+		Type:     nested.Type,
+		Required: true,
+		Nullable: nested.Type == schema.Null,
+		Nested:   nested,
+	}
+}
+
+// mergeFields merges two observations of the same field. A field stays
+// required only if both observations required it.
+func mergeFields(a, b *schema.FieldSchema) *schema.FieldSchema {
+	if a == nil {
+		return b
+	}
+	if b == nil {
+		return a
+	}
+
+	nested := mergeSchemas(a.Nested, b.Nested)
+	return &schema.FieldSchema{
+		Name:     a.Name,
+		Type:     nested.Type,
+		Required: a.Required && b.Required,
+		Nullable: a.Nullable || b.Nullable,
+		Nested:   nested,
+	}
+}
+
+// mergeSchemas merges two schemas observed for the same value. Nulls
+// give way to any other type (nullability is tracked on the field),
+// objects merge their fields, arrays merge their items and different
+// types widen to a union.
+func mergeSchemas(a, b *schema.Schema) *schema.Schema {
+	switch {
+	case a == nil:
+		return b
+	case b == nil:
+		return a
+	case a.Type == schema.Null:
+		return b
+	case b.Type == schema.Null:
+		return a
+	case a.Type.IsNumeric() && b.Type.IsNumeric() && a.Type != b.Type:
+		return &schema.Schema{Type: widenNumeric(a.Type, b.Type)}
+	case a.Type == schema.Union || b.Type == schema.Union || a.Type != b.Type:
+		return mergeUnion(a, b)
+	}
+
+	switch a.Type {
+	case schema.Object:
+		fields := make(map[string]*schema.FieldSchema)
+		for name, field := range a.Fields {
+			fields[name] = field
+		}
+		for name, field := range b.Fields {
+			fields[name] = mergeFields(fields[name], field)
+		}
+		for name, field := range fields {
+			if a.Fields[name] == nil || b.Fields[name] == nil {
+				optional := *field
+				optional.Required = false // missing from some objects
+				fields[name] = &optional
+			}
+		}
+		return &schema.Schema{Type: schema.Object, Fields: fields}
+	case schema.Array:
+		return &schema.Schema{Type: schema.Array, Items: mergeFields(a.Items, b.Items)}
+	default:
+		return &schema.Schema{Type: a.Type}
+	}
+}
+
+// widenNumeric returns the narrowest numeric type holding both types:
+// integers and floats widen to Float, anything with Number to Number
+func widenNumeric(a, b schema.DataType) schema.DataType {
+	if a == schema.Number || b == schema.Number {
+		return schema.Number
+	}
+	return schema.Float
+}
+
+// mergeUnion widens two schemas to a union with one member per type
+func mergeUnion(a, b *schema.Schema) *schema.Schema {
+	var members []*schema.Schema
+	all := append(append([]*schema.Schema{}, unionMembers(a)...), unionMembers(b)...)
+	for _, s := range all {
+		merged := false
+		for i, member := range members {
+			if member.Type == s.Type || member.Type.IsNumeric() && s.Type.IsNumeric() {
+				members[i] = mergeSchemas(member, s)
+				merged = true
+				break
+			}
+		}
+		if !merged {
+			members = append(members, s)
+		}
+	}
+
+	if len(members) == 1 {
+		return members[0]
+	}
+	return &schema.Schema{Type: schema.Union, Members: members}
+}
+
+// unionMembers returns the member schemas of a union, or the schema itself
+func unionMembers(s *schema.Schema) []*schema.Schema {
+	if s.Type == schema.Union {
+		return s.Members
+	}
+	return []*schema.Schema{s}
+}
@@ -0,0 +1,34 @@
+// Package parsers provides format-specific parsing for Aomi
+// Record streams for inputs larger than memory :0
+package parsers
+
+import (
+	"context"
+	"io"
+
+	"github.com/loveucifer/aomi/pkg/schema"
+)
+
+// RecordReader reads a stream of records one at a time
+type RecordReader interface {
+	// Next returns the next record with its key order, or io.EOF after
+	// the last one
+	Next() (record interface{}, order *schema.KeyOrder, err error)
+}
+
+// StreamingParser is a Parser that can also read its input as a stream of
+// records without loading it whole
+type StreamingParser interface {
+	Parser
+	// CanStream reports whether input starting with prefix is a stream of
+	// records (e.g. a JSON array rather than a single object)
+	CanStream(prefix []byte) bool
+	Records(ctx context.Context, r io.Reader) (RecordReader, error)
+}
+
+// Built-in parsers that stream
+var (
+	_ StreamingParser = (*JSONParser)(nil)
+	_ StreamingParser = (*CSVParser)(nil)
+	_ StreamingParser = (*NDJSONParser)(nil)
+)
@@ -3,26 +3,154 @@
 package parsers
 
 import (
+	"context"
+	"io"
+
 	"github.com/loveucifer/aomi/pkg/schema"
 	"github.com/pelletier/go-toml/v2"
+	"github.com/pelletier/go-toml/v2/unstable"
 )
 
 // TOMLParser parses TOML data into the internal document model
 type TOMLParser struct{}
 
-// Parse parses TOML data into a Document
-func (p *TOMLParser) Parse(data []byte) (*schema.Document, error) {
+// Parse reads TOML from r into a Document
+func (p *TOMLParser) Parse(ctx context.Context, r io.Reader) (*schema.Document, error) {
+	data, err := readAll(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+	return p.parse(data)
+}
+
+// parse parses TOML data into a Document
+func (p *TOMLParser) parse(data []byte) (*schema.Document, error) {
 	var raw interface{}
 	if err := toml.Unmarshal(data, &raw); err != nil {
 		return nil, err // :0 parsing failed
 	}
 
+	order, err := tomlKeyOrder(data)
+	if err != nil {
+		return nil, err
+	}
+
+	raw = fromTOMLValue(raw)
+
 	// Create schema based on the TOML structure
 	schemaObj := inferSchema(raw) // :D auto-detect structure
 	doc := &schema.Document{
 		Schema: schemaObj,
 		Data:   raw,
+		Order:  order,
 	}
 
 	return doc, nil // :) success
 }
+
+// fromTOMLValue replaces go-toml's local date and time values with the
+// document's own types
+func fromTOMLValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, item := range v {
+			v[key] = fromTOMLValue(item)
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = fromTOMLValue(item)
+		}
+	case toml.LocalDate:
+		return schema.LocalDate{Year: v.Year, Month: v.Month, Day: v.Day}
+	case toml.LocalTime:
+		return fromTOMLTime(v)
+	case toml.LocalDateTime:
+		return schema.LocalDateTime{
+			LocalDate: schema.LocalDate{Year: v.Year, Month: v.Month, Day: v.Day},
+			LocalTime: fromTOMLTime(v.LocalTime),
+		}
+	}
+	return value
+}
+
+func fromTOMLTime(t toml.LocalTime) schema.LocalTime {
+	return schema.LocalTime{Hour: t.Hour, Minute: t.Minute, Second: t.Second, Nanosecond: t.Nanosecond, Precision: t.Precision}
+}
+
+// tomlKeyOrder walks the TOML expressions to record the order of keys,
+// which toml.Unmarshal loses by decoding into maps
+func tomlKeyOrder(data []byte) (*schema.KeyOrder, error) {
+	root := schema.NewKeyOrder()
+	current := root
+
+	var parser unstable.Parser
+	parser.Reset(data)
+	for parser.NextExpression() {
+		expr := parser.Expression()
+		switch expr.Kind {
+		case unstable.Table, unstable.ArrayTable:
+			current = root
+			key := expr.Key()
+			for key.Next() {
+				current = current.AddKey(string(key.Node().Data))
+				if expr.Kind == unstable.ArrayTable && key.IsLast() {
+					elem := schema.NewKeyOrder()
+					current.Elems = append(current.Elems, elem)
+					current = elem
+				} else if n := len(current.Elems); n > 0 {
+					// [a.b] after [[a]] refers to the last element of a
+					current = current.Elems[n-1]
+				}
+			}
+		case unstable.KeyValue:
+			tomlKeyValueOrder(expr, current)
+		}
+	}
+
+	tomlMergeElems(root)
+	return root, parser.Error()
+}
+
+// tomlKeyValueOrder records a (possibly dotted) key and its value's keys
+func tomlKeyValueOrder(kv *unstable.Node, order *schema.KeyOrder) {
+	key := kv.Key()
+	for key.Next() {
+		order = order.AddKey(string(key.Node().Data))
+	}
+	tomlValueOrder(kv.Value(), order)
+}
+
+// tomlValueOrder records the keys of inline tables and arrays
+func tomlValueOrder(value *unstable.Node, order *schema.KeyOrder) {
+	switch value.Kind {
+	case unstable.InlineTable:
+		children := value.Children()
+		for children.Next() {
+			tomlKeyValueOrder(children.Node(), order)
+		}
+	case unstable.Array:
+		order.AddItem()
+		children := value.Children()
+		for children.Next() {
+			elem := schema.NewKeyOrder()
+			tomlValueOrder(children.Node(), elem)
+			order.AddElem(elem)
+		}
+	}
+}
+
+// tomlMergeElems fills in the Items of array tables, whose elements are
+// only complete once the whole file is read
+func tomlMergeElems(order *schema.KeyOrder) {
+	if order == nil {
+		return
+	}
+	for _, key := range order.Keys {
+		tomlMergeElems(order.Fields[key])
+	}
+	tomlMergeElems(order.Items)
+	for _, elem := range order.Elems {
+		tomlMergeElems(elem)
+		order.AddItem().Merge(elem)
+	}
+}
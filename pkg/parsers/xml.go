@@ -3,47 +3,237 @@
 package parsers
 
 import (
-	"github.com/loveucifer/aomi/pkg/schema"
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
 	"strings"
+
+	"github.com/loveucifer/aomi/pkg/schema"
+)
+
+// Default key conventions used when mapping XML onto the document model
+const (
+	DefaultXMLAttrPrefix = "@"
+	DefaultXMLTextKey    = "#text"
 )
 
 // XMLParser parses XML data into the internal document model
-type XMLParser struct{}
+//
+// Elements become nested maps keyed by tag name, repeated sibling
+// elements become arrays, attributes are stored under AttrPrefix+name
+// and character data of elements that also carry attributes or children
+// is stored under TextKey. In mixed content the text pieces around the
+// children are trimmed and joined with a space, in order, and TextKey
+// takes the place of the first one among the children. Namespace
+// prefixes are kept as written (e.g. "soap:Body", "@xmlns:soap") so they
+// survive a round trip.
+type XMLParser struct {
+	AttrPrefix string
+	TextKey    string
+}
 
-// Parse parses XML data into a Document
-func (p *XMLParser) Parse(data []byte) (*schema.Document, error) {
-	// For now, convert XML to a generic structure
-	// In a real implementation, we'd use more sophisticated XML parsing
+// NewXMLParser creates a new XML parser with default settings
+func NewXMLParser() *XMLParser {
+	return &XMLParser{
+		AttrPrefix: DefaultXMLAttrPrefix,
+		TextKey:    DefaultXMLTextKey,
+	}
+}
+
+// Parse reads XML from r into a Document
+func (p *XMLParser) Parse(ctx context.Context, r io.Reader) (*schema.Document, error) {
+	data, err := readAll(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+	return p.parse(data)
+}
 
-	// Simple approach: return the raw XML for now
-	result := map[string]interface{}{
-		"_raw_xml": string(data),
+// parse parses XML data into a Document
+func (p *XMLParser) parse(data []byte) (*schema.Document, error) {
+	result, order, err := p.xmlToMap(data)
+	if err != nil {
+		return nil, err // :0 parsing failed
 	}
 
 	schemaObj := inferSchema(result) // :D auto-detect structure
 	doc := &schema.Document{
 		Schema: schemaObj,
 		Data:   result,
+		Order:  order,
 	}
 
 	return doc, nil // :) success
 }
 
-// xmlToMap converts XML string to a map structure
-func xmlToMap(xmlStr string) interface{} {
-	// This is a simplified XML to map converter
-	// In a real implementation, we'd use proper XML parsing
-	trimmed := strings.TrimSpace(xmlStr)
+// xmlElement collects the state of an element while it is being decoded
+type xmlElement struct {
+	name     string
+	fields   map[string]interface{}
+	order    *schema.KeyOrder
+	text     strings.Builder // text since the last child
+	segments []string        // trimmed text pieces between children
+	textAt   int             // position of the text among the keys
+	hasChild bool
+}
 
-	// Check if it's an array-like structure (has multiple root elements)
-	if strings.HasPrefix(trimmed, "<?xml") {
-		// Remove XML declaration
-		trimmed = strings.SplitN(trimmed, ">", 2)[1]
+// xmlToMap converts an XML byte stream to a map keyed by the root element,
+// along with the document order of attributes and child elements
+func (p *XMLParser) xmlToMap(data []byte) (map[string]interface{}, *schema.KeyOrder, error) {
+	attrPrefix := p.AttrPrefix
+	if attrPrefix == "" {
+		attrPrefix = DefaultXMLAttrPrefix
+	}
+	textKey := p.TextKey
+	if textKey == "" {
+		textKey = DefaultXMLTextKey
 	}
 
-	// Return raw XML as a fallback structure
-	// Full XML parsing implementation would go here
-	return map[string]interface{}{
-		"_raw_xml": trimmed,
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	decoder.Strict = true
+
+	var (
+		stack  []*xmlElement
+		result map[string]interface{}
+		order  = schema.NewKeyOrder()
+	)
+
+	for {
+		// RawToken keeps namespace prefixes instead of resolving them to URLs
+		token, err := decoder.RawToken()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			if len(stack) == 0 && result != nil {
+				return nil, nil, fmt.Errorf("xml: multiple root elements (found <%s>)", xmlName(t.Name))
+			}
+
+			elem := &xmlElement{
+				name:   xmlName(t.Name),
+				fields: make(map[string]interface{}),
+				order:  schema.NewKeyOrder(),
+			}
+			for _, attr := range t.Attr {
+				key := attrPrefix + xmlName(attr.Name)
+				elem.fields[key] = attr.Value
+				elem.order.AddKey(key)
+			}
+			if len(stack) > 0 {
+				parent := stack[len(stack)-1]
+				parent.endText()
+				parent.hasChild = true
+			}
+			stack = append(stack, elem)
+
+		case xml.EndElement:
+			if len(stack) == 0 {
+				return nil, nil, fmt.Errorf("xml: unexpected end element </%s>", xmlName(t.Name))
+			}
+			elem := stack[len(stack)-1]
+			if name := xmlName(t.Name); name != elem.name {
+				return nil, nil, fmt.Errorf("xml: element <%s> closed by </%s>", elem.name, name)
+			}
+			stack = stack[:len(stack)-1]
+
+			value := elem.value(textKey)
+			parentOrder := order
+			if len(stack) == 0 {
+				result = map[string]interface{}{elem.name: value}
+			} else {
+				parent := stack[len(stack)-1]
+				addXMLChild(parent.fields, elem.name, value)
+				parentOrder = parent.order
+			}
+
+			// Repeated siblings become an array whose elements keep their
+			// own order; the slot itself holds the order of a single one
+			slot := parentOrder.AddKey(elem.name)
+			slot.Merge(elem.order)
+			slot.AddElem(elem.order)
+
+		case xml.CharData:
+			// CDATA sections arrive as CharData too, already unescaped
+			if len(stack) > 0 {
+				stack[len(stack)-1].text.Write(t)
+			} else if len(bytes.TrimSpace(t)) > 0 {
+				return nil, nil, fmt.Errorf("xml: text outside of root element")
+			}
+		}
+		// Comments, processing instructions and directives carry no data
+	}
+
+	if len(stack) > 0 {
+		return nil, nil, fmt.Errorf("xml: unclosed element <%s>", stack[len(stack)-1].name)
+	}
+	if result == nil {
+		return nil, nil, fmt.Errorf("xml: no root element")
+	}
+
+	return result, order, nil
+}
+
+// endText ends the piece of text before a child or the end tag
+func (e *xmlElement) endText() {
+	text := strings.TrimSpace(e.text.String())
+	e.text.Reset()
+	if text == "" {
+		return
+	}
+	if len(e.segments) == 0 {
+		e.textAt = len(e.order.Keys)
+	}
+	e.segments = append(e.segments, text)
+}
+
+// value returns the document representation of a finished element
+func (e *xmlElement) value(textKey string) interface{} {
+	e.endText()
+	text := strings.Join(e.segments, " ")
+
+	// Plain leaf element: just its text
+	if len(e.fields) == 0 {
+		return text
+	}
+
+	// Attributes and/or children, with text kept alongside (mixed content)
+	// where it first appeared
+	if text != "" {
+		e.fields[textKey] = text
+		e.order.AddKey(textKey)
+		keys := e.order.Keys
+		copy(keys[e.textAt+1:], keys[e.textAt:len(keys)-1])
+		keys[e.textAt] = textKey
+	}
+	return e.fields
+}
+
+// addXMLChild adds a child value, turning repeated siblings into an array
+func addXMLChild(fields map[string]interface{}, name string, value interface{}) {
+	existing, ok := fields[name]
+	if !ok {
+		fields[name] = value
+		return
+	}
+
+	if arr, ok := existing.([]interface{}); ok {
+		fields[name] = append(arr, value)
+		return
+	}
+	fields[name] = []interface{}{existing, value}
+}
+
+// xmlName renders a raw XML name with its namespace prefix, if any
+func xmlName(name xml.Name) string {
+	if name.Space == "" {
+		return name.Local
 	}
+	return name.Space + ":" + name.Local
 }
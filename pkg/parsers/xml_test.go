@@ -0,0 +1,119 @@
+package parsers
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestXMLParser(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    string   // data as JSON
+		keys    []string // key order of the root element
+		wantErr string
+	}{
+		{
+			name:  "leaf element",
+			input: "<name> Ann </name>",
+			want:  `{"name":"Ann"}`,
+		},
+		{
+			name:  "attributes and children in order",
+			input: `<user id="7" role="admin"><name>Ann</name><age>30</age></user>`,
+			want:  `{"user":{"@id":"7","@role":"admin","age":"30","name":"Ann"}}`,
+			keys:  []string{"@id", "@role", "name", "age"},
+		},
+		{
+			name:  "repeated siblings become an array",
+			input: "<list><item>a</item><item>b</item><item>c</item></list>",
+			want:  `{"list":{"item":["a","b","c"]}}`,
+			keys:  []string{"item"},
+		},
+		{
+			name:  "text of an element with attributes",
+			input: `<price currency="EUR">9.50</price>`,
+			want:  `{"price":{"#text":"9.50","@currency":"EUR"}}`,
+			keys:  []string{"@currency", "#text"},
+		},
+		{
+			name:  "cdata is text",
+			input: "<code><![CDATA[a < b && c]]></code>",
+			want:  `{"code":"a < b && c"}`,
+		},
+		{
+			name:  "namespace prefixes are kept",
+			input: `<soap:Envelope xmlns:soap="urn:s"><soap:Body>x</soap:Body></soap:Envelope>`,
+			want:  `{"soap:Envelope":{"@xmlns:soap":"urn:s","soap:Body":"x"}}`,
+			keys:  []string{"@xmlns:soap", "soap:Body"},
+		},
+		{
+			name:  "mixed content joins text in order",
+			input: "<p>Hello <b>world</b> again</p>",
+			want:  `{"p":{"#text":"Hello again","b":"world"}}`,
+			keys:  []string{"#text", "b"},
+		},
+		{
+			name:  "text after a child stays after it",
+			input: "<p><b>world</b> again</p>",
+			want:  `{"p":{"#text":"again","b":"world"}}`,
+			keys:  []string{"b", "#text"},
+		},
+		{
+			name:    "multiple roots",
+			input:   "<a/><b/>",
+			wantErr: "xml: multiple root elements (found <b>)",
+		},
+		{
+			name:    "text outside the root",
+			input:   "<a/>text",
+			wantErr: "xml: text outside of root element",
+		},
+		{
+			name:    "no root",
+			input:   "<!-- nothing -->",
+			wantErr: "xml: no root element",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := NewXMLParser().parse([]byte(tt.input))
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("parse() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parse: %v", err)
+			}
+
+			var got strings.Builder
+			enc := json.NewEncoder(&got)
+			enc.SetEscapeHTML(false)
+			if err := enc.Encode(doc.Data); err != nil {
+				t.Fatalf("encode: %v", err)
+			}
+			if strings.TrimSpace(got.String()) != tt.want {
+				t.Errorf("parse() = %s, want %s", got.String(), tt.want)
+			}
+
+			if tt.keys != nil {
+				root := doc.Order.Keys[0]
+				if keys := doc.Order.Field(root).Keys; !reflect.DeepEqual(keys, tt.keys) {
+					t.Errorf("key order = %v, want %v", keys, tt.keys)
+				}
+			}
+		})
+	}
+}
+
+func TestXMLParserMismatchedClose(t *testing.T) {
+	_, err := NewXMLParser().parse([]byte("<a><b></a></b>"))
+	if err == nil {
+		t.Fatal("parse() succeeded, want an error")
+	}
+}
@@ -3,26 +3,238 @@
 package parsers
 
 import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
 	"github.com/loveucifer/aomi/pkg/schema"
 	"gopkg.in/yaml.v3"
 )
 
 // YAMLParser parses YAML data into the internal document model
-type YAMLParser struct{}
+type YAMLParser struct {
+	// PreserveNodes keeps the parsed *yaml.Node trees in Document.Nodes so
+	// YAML output can keep comments, anchors, aliases and merge keys
+	PreserveNodes bool
+}
 
-// Parse parses YAML data into a Document
-func (p *YAMLParser) Parse(data []byte) (*schema.Document, error) {
-	var raw interface{}
-	if err := yaml.Unmarshal(data, &raw); err != nil {
+// Parse reads YAML from r into a Document
+func (p *YAMLParser) Parse(ctx context.Context, r io.Reader) (*schema.Document, error) {
+	data, err := readAll(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+	return p.parse(data)
+}
+
+// parse parses YAML data into a Document. A stream of several ---
+// separated documents becomes a Stream document holding one element per
+// document.
+func (p *YAMLParser) parse(data []byte) (*schema.Document, error) {
+	nodes, err := yamlDocuments(data)
+	if err != nil {
 		return nil, err // :0 parsing failed
 	}
 
+	order := schema.NewKeyOrder()
+	var raw interface{}
+	switch len(nodes) {
+	case 0:
+		// empty input
+	case 1:
+		if raw, err = yamlValue(nodes[0], order); err != nil {
+			return nil, err
+		}
+	default:
+		documents := make([]interface{}, 0, len(nodes))
+		order.AddItem()
+		for _, node := range nodes {
+			elem := schema.NewKeyOrder()
+			value, err := yamlValue(node, elem)
+			if err != nil {
+				return nil, err
+			}
+			documents = append(documents, value)
+			order.AddElem(elem)
+		}
+		raw = documents
+	}
+
 	// Create schema based on the YAML structure
 	schemaObj := inferSchema(raw) // :D auto-detect structure
 	doc := &schema.Document{
 		Schema: schemaObj,
 		Data:   raw,
+		Order:  order,
+		Stream: len(nodes) > 1,
+	}
+	if p.PreserveNodes {
+		for _, node := range nodes {
+			doc.Nodes = append(doc.Nodes, node)
+		}
 	}
 
 	return doc, nil // :) success
 }
+
+// yamlDocuments decodes every document of a YAML stream, skipping empty
+// ones such as the one after a trailing ---
+func yamlDocuments(data []byte) ([]*yaml.Node, error) {
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+
+	var nodes []*yaml.Node
+	for {
+		node := &yaml.Node{}
+		err := decoder.Decode(node)
+		if err == io.EOF {
+			return nodes, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if !isEmptyYAMLDocument(node) {
+			nodes = append(nodes, node)
+		}
+	}
+}
+
+// YAMLNodeValue converts a parsed YAML node to document data the way the
+// YAML parser does, expanding aliases and merge keys
+func YAMLNodeValue(node *yaml.Node) (interface{}, error) {
+	return yamlValue(node, schema.NewKeyOrder())
+}
+
+// isEmptyYAMLDocument reports whether a document has no content at all,
+// as opposed to an explicit null
+func isEmptyYAMLDocument(node *yaml.Node) bool {
+	if len(node.Content) == 0 {
+		return true
+	}
+	content := node.Content[0]
+	return content.Kind == yaml.ScalarNode && content.ShortTag() == "!!null" && content.Value == ""
+}
+
+// yamlValue converts a YAML node to document data, recording the order of
+// mapping keys. Aliases are expanded and merge keys (<<: *base) resolved.
+func yamlValue(node *yaml.Node, order *schema.KeyOrder) (interface{}, error) {
+	switch node.Kind {
+	case 0:
+		return nil, nil // empty input
+	case yaml.DocumentNode:
+		if len(node.Content) == 0 {
+			return nil, nil
+		}
+		return yamlValue(node.Content[0], order)
+	case yaml.AliasNode:
+		return yamlValue(node.Alias, order)
+	case yaml.SequenceNode:
+		arr := make([]interface{}, 0, len(node.Content))
+		order.AddItem()
+		for _, child := range node.Content {
+			elem := schema.NewKeyOrder()
+			value, err := yamlValue(child, elem)
+			if err != nil {
+				return nil, err
+			}
+			arr = append(arr, value)
+			order.AddElem(elem)
+		}
+		return arr, nil
+	case yaml.MappingNode:
+		return yamlMapping(node, order)
+	default:
+		return yamlScalar(node)
+	}
+}
+
+// yamlMapping converts a mapping node. Keys written in the mapping win
+// over merged keys, and earlier merges win over later ones.
+func yamlMapping(node *yaml.Node, order *schema.KeyOrder) (interface{}, error) {
+	obj := make(map[string]interface{})
+
+	explicit := make(map[string]bool)
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if key := node.Content[i]; key.ShortTag() != "!!merge" {
+			explicit[key.Value] = true
+		}
+	}
+
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, value := node.Content[i], node.Content[i+1]
+
+		if key.ShortTag() == "!!merge" {
+			merged := []*yaml.Node{value}
+			if value.Kind == yaml.SequenceNode {
+				merged = value.Content
+			}
+			for _, m := range merged {
+				// Merged keys appear where the merge is written, unless
+				// the mapping sets them itself
+				mergedOrder := schema.NewKeyOrder()
+				decoded, err := yamlValue(m, mergedOrder)
+				if err != nil {
+					return nil, err
+				}
+				mergedMap, ok := decoded.(map[string]interface{})
+				if !ok {
+					return nil, fmt.Errorf("yaml: line %d: merge value must be a mapping", m.Line)
+				}
+				for _, k := range mergedOrder.Keys {
+					if !explicit[k] {
+						order.AddKey(k).Merge(mergedOrder.Fields[k])
+					}
+				}
+				for k, v := range mergedMap {
+					if _, exists := obj[k]; !exists && !explicit[k] {
+						obj[k] = v
+					}
+				}
+			}
+			continue
+		}
+
+		decoded, err := yamlValue(value, order.AddKey(key.Value))
+		if err != nil {
+			return nil, err
+		}
+		obj[key.Value] = decoded
+	}
+
+	return obj, nil
+}
+
+// yamlScalar decodes a scalar node with YAML's own type resolution, keeping
+// date-only timestamps as dates rather than midnight UTC date-times, and
+// reading plain date-times without a zone (1979-05-27T07:32:00) as local
+// date-times instead of strings
+func yamlScalar(node *yaml.Node) (interface{}, error) {
+	var value interface{}
+	if err := node.Decode(&value); err != nil {
+		return nil, err
+	}
+
+	switch v := value.(type) {
+	case time.Time:
+		if len(strings.TrimSpace(node.Value)) == len("2006-01-02") {
+			return schema.LocalDate{Year: v.Year(), Month: int(v.Month()), Day: v.Day()}, nil
+		}
+	case int:
+		return int64(v), nil // the same integer type as other formats
+	case uint64, float64:
+		// Integers beyond int64 and decimals keep their exact digits
+		if jsonNumberPattern.MatchString(node.Value) {
+			return exactNumber(node.Value), nil
+		}
+	case string:
+		if node.Style == 0 && node.Tag == "!!str" {
+			var local schema.LocalDateTime
+			if err := local.UnmarshalText([]byte(v)); err == nil {
+				return local, nil
+			}
+		}
+	}
+	return value, nil
+}
@@ -0,0 +1,130 @@
+// Package schema provides the internal document structure for Aomi
+// Dates and times without a time zone :0
+package schema
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Document data holds zoned date-times as time.Time and values without a
+// time zone as the types below, whatever format they were read from.
+
+// LocalDate is a calendar date without a time zone, e.g. 1979-05-27
+type LocalDate struct {
+	Year  int
+	Month int
+	Day   int
+}
+
+// String formats the date as in RFC 3339
+func (d LocalDate) String() string {
+	return fmt.Sprintf("%04d-%02d-%02d", d.Year, d.Month, d.Day)
+}
+
+// MarshalText formats the date as in RFC 3339
+func (d LocalDate) MarshalText() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+// UnmarshalText reads an RFC 3339 date
+func (d *LocalDate) UnmarshalText(text []byte) error {
+	t, err := time.Parse("2006-01-02", string(text))
+	if err != nil {
+		return fmt.Errorf("invalid date %q", text)
+	}
+	*d = LocalDate{Year: t.Year(), Month: int(t.Month()), Day: t.Day()}
+	return nil
+}
+
+// LocalTime is a time of day without a time zone, e.g. 07:32:00.999
+type LocalTime struct {
+	Hour       int
+	Minute     int
+	Second     int
+	Nanosecond int
+	Precision  int // Digits of the fraction to write, up to 9; 0 writes as few as needed
+}
+
+// maxTimePrecision is the number of fraction digits a nanosecond holds
+const maxTimePrecision = 9
+
+// String formats the time as in RFC 3339
+func (t LocalTime) String() string {
+	s := fmt.Sprintf("%02d:%02d:%02d", t.Hour, t.Minute, t.Second)
+	if t.Precision > 0 {
+		s += fmt.Sprintf(".%09d", t.Nanosecond)[:min(t.Precision, maxTimePrecision)+1]
+	} else if t.Nanosecond > 0 {
+		s += strings.TrimRight(fmt.Sprintf(".%09d", t.Nanosecond), "0")
+	}
+	return s
+}
+
+// MarshalText formats the time as in RFC 3339
+func (t LocalTime) MarshalText() ([]byte, error) {
+	return []byte(t.String()), nil
+}
+
+// UnmarshalText reads an RFC 3339 time of day, keeping the number of
+// fraction digits. Fractions finer than a nanosecond are rejected rather
+// than cut.
+func (t *LocalTime) UnmarshalText(text []byte) error {
+	s := string(text)
+	parsed, err := time.Parse("15:04:05.999999999", s)
+	if err != nil {
+		return fmt.Errorf("invalid time %q", text)
+	}
+
+	precision := 0
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		precision = len(s) - i - 1
+	}
+	if precision > maxTimePrecision {
+		return fmt.Errorf("invalid time %q: more than %d fraction digits", text, maxTimePrecision)
+	}
+	*t = LocalTime{
+		Hour:       parsed.Hour(),
+		Minute:     parsed.Minute(),
+		Second:     parsed.Second(),
+		Nanosecond: parsed.Nanosecond(),
+		Precision:  precision,
+	}
+	return nil
+}
+
+// LocalDateTime is a date and time without a time zone, e.g.
+// 1979-05-27T07:32:00
+type LocalDateTime struct {
+	LocalDate
+	LocalTime
+}
+
+// String formats the date-time as in RFC 3339
+func (dt LocalDateTime) String() string {
+	return dt.LocalDate.String() + "T" + dt.LocalTime.String()
+}
+
+// MarshalText formats the date-time as in RFC 3339
+func (dt LocalDateTime) MarshalText() ([]byte, error) {
+	return []byte(dt.String()), nil
+}
+
+// UnmarshalText reads an RFC 3339 date-time without an offset; the date
+// and time may be separated by T or a space
+func (dt *LocalDateTime) UnmarshalText(text []byte) error {
+	s := string(text)
+	if len(s) < len("2006-01-02T") || !strings.ContainsRune("Tt ", rune(s[10])) {
+		return fmt.Errorf("invalid date-time %q", text)
+	}
+
+	var parsed LocalDateTime
+	if err := parsed.LocalDate.UnmarshalText([]byte(s[:10])); err != nil {
+		return fmt.Errorf("invalid date-time %q", text)
+	}
+	if err := parsed.LocalTime.UnmarshalText([]byte(s[11:])); err != nil {
+		return fmt.Errorf("invalid date-time %q", text)
+	}
+	*dt = parsed
+	return nil
+}
@@ -0,0 +1,103 @@
+package schema
+
+import "testing"
+
+func TestLocalTimeText(t *testing.T) {
+	tests := []struct {
+		text    string
+		want    string // String() after UnmarshalText
+		wantErr bool
+	}{
+		{text: "07:32:00", want: "07:32:00"},
+		{text: "07:32:00.5", want: "07:32:00.5"},
+		{text: "07:32:00.500", want: "07:32:00.500"},
+		{text: "07:32:00.123456789", want: "07:32:00.123456789"},
+		{text: "07:32:00.1234567891", wantErr: true},
+		{text: "25:00:00", wantErr: true},
+		{text: "7:32", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			var clock LocalTime
+			err := clock.UnmarshalText([]byte(tt.text))
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("UnmarshalText(%q) = %v, want an error", tt.text, clock)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("UnmarshalText(%q): %v", tt.text, err)
+			}
+			if got := clock.String(); got != tt.want {
+				t.Errorf("String() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLocalTimeStringPrecision(t *testing.T) {
+	tests := []struct {
+		clock LocalTime
+		want  string
+	}{
+		{LocalTime{Hour: 7, Nanosecond: 120000000}, "07:00:00.12"},
+		{LocalTime{Hour: 7, Nanosecond: 120000000, Precision: 4}, "07:00:00.1200"},
+		{LocalTime{Hour: 7, Nanosecond: 1, Precision: 12}, "07:00:00.000000001"},
+	}
+
+	for _, tt := range tests {
+		if got := tt.clock.String(); got != tt.want {
+			t.Errorf("%+v.String() = %q, want %q", tt.clock, got, tt.want)
+		}
+	}
+}
+
+func TestLocalDateTimeText(t *testing.T) {
+	tests := []struct {
+		text    string
+		want    string
+		wantErr bool
+	}{
+		{text: "1979-05-27T07:32:00", want: "1979-05-27T07:32:00"},
+		{text: "1979-05-27 07:32:00.25", want: "1979-05-27T07:32:00.25"},
+		{text: "1979-05-27t07:32:00", want: "1979-05-27T07:32:00"},
+		{text: "1979-05-27", wantErr: true},
+		{text: "1979-05-27T07:32:00Z", wantErr: true},
+		{text: "1979-02-30T07:32:00", wantErr: true},
+		{text: "1979-05-27T07:32:00.1234567891", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			var dt LocalDateTime
+			err := dt.UnmarshalText([]byte(tt.text))
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("UnmarshalText(%q) = %v, want an error", tt.text, dt)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("UnmarshalText(%q): %v", tt.text, err)
+			}
+			if got := dt.String(); got != tt.want {
+				t.Errorf("String() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLocalDateText(t *testing.T) {
+	var date LocalDate
+	if err := date.UnmarshalText([]byte("1979-05-27")); err != nil {
+		t.Fatalf("UnmarshalText: %v", err)
+	}
+	if date != (LocalDate{Year: 1979, Month: 5, Day: 27}) || date.String() != "1979-05-27" {
+		t.Errorf("UnmarshalText(1979-05-27) = %+v (%s)", date, date)
+	}
+	if err := date.UnmarshalText([]byte("1979-13-01")); err == nil {
+		t.Errorf("UnmarshalText(1979-13-01) succeeded, want an error")
+	}
+}
@@ -7,29 +7,83 @@ type DataType int
 
 const (
 	String DataType = iota
-	Number
+	Number          // Any number, when integers and floats can't be told apart
 	Boolean
 	Array
 	Object
+	Null  // Only null values were seen
+	Union // Several types were seen, see Schema.Members
+	Integer
+	Float
+	DateTime // Date and time, with or without a time zone
+	Date     // Calendar date without a time of day
+	Time     // Time of day without a date
 )
 
+// String returns the name of a data type
+func (t DataType) String() string {
+	switch t {
+	case String:
+		return "string"
+	case Number:
+		return "number"
+	case Boolean:
+		return "boolean"
+	case Array:
+		return "array"
+	case Object:
+		return "object"
+	case Null:
+		return "null"
+	case Union:
+		return "union"
+	case Integer:
+		return "integer"
+	case Float:
+		return "float"
+	case DateTime:
+		return "datetime"
+	case Date:
+		return "date"
+	case Time:
+		return "time"
+	default:
+		return "unknown"
+	}
+}
+
+// IsNumeric reports whether the type is Number, Integer or Float
+func (t DataType) IsNumeric() bool {
+	return t == Number || t == Integer || t == Float
+}
+
 // Document represents parsed data with its schema
 type Document struct {
 	Schema *Schema
-	Data   interface{}
+	Data   interface{} // Numbers are int64, float64 or json.Number (exact digits)
+	Order  *KeyOrder   // Source key order; nil means keys are sorted
+	Stream bool        // Data is a []interface{} of separate documents, e.g. a YAML --- stream
+
+	// Nodes holds source nodes a parser kept for the writer of its format,
+	// one per document of a stream, such as the yaml.Node trees that keep
+	// YAML comments and anchors. Only that format's packages know their
+	// type; the writer reuses them where Data is unchanged.
+	Nodes []interface{}
 }
 
 // Schema describes the structure of data
 type Schema struct {
-	Type   DataType
-	Fields map[string]*FieldSchema // For object types
-	Items  *FieldSchema            // For array types
+	Type    DataType
+	Fields  map[string]*FieldSchema // For object types
+	Items   *FieldSchema            // For array types
+	Members []*Schema               // For union types, one per member type
 }
 
 // FieldSchema describes a field in the schema
 type FieldSchema struct {
 	Name     string
 	Type     DataType
-	Required bool
+	Required bool    // Present in every object that was inspected
+	Nullable bool    // Null in at least one object
 	Nested   *Schema // For complex types :0
 }
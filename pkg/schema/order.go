@@ -0,0 +1,143 @@
+// Package schema provides the internal document structure for Aomi
+// Key order side-table so conversions keep the author's field order :)
+package schema
+
+import "sort"
+
+// KeyOrder records the order in which object keys appeared in the source.
+//
+// It mirrors the shape of Document.Data: for an object, Keys lists its keys
+// and Fields holds the order of each nested value; for an array, Elems holds
+// the order of each element and Items the first-seen union of their keys,
+// for outputs such as CSV headers that need one order for all elements. A
+// nil *KeyOrder is valid and means "no known order".
+type KeyOrder struct {
+	Keys   []string
+	Fields map[string]*KeyOrder
+	Items  *KeyOrder
+	Elems  []*KeyOrder // by index; may be shorter than the array
+}
+
+// NewKeyOrder creates an empty key order
+func NewKeyOrder(keys ...string) *KeyOrder {
+	o := &KeyOrder{}
+	for _, key := range keys {
+		o.AddKey(key)
+	}
+	return o
+}
+
+// AddKey records a key (if it is new) and returns the order of its value
+func (o *KeyOrder) AddKey(key string) *KeyOrder {
+	if o.Fields == nil {
+		o.Fields = make(map[string]*KeyOrder)
+	}
+
+	child, ok := o.Fields[key]
+	if !ok {
+		child = &KeyOrder{}
+		o.Fields[key] = child
+		o.Keys = append(o.Keys, key)
+	}
+	return child
+}
+
+// AddItem returns the order shared by array elements, creating it if needed
+func (o *KeyOrder) AddItem() *KeyOrder {
+	if o.Items == nil {
+		o.Items = &KeyOrder{}
+	}
+	return o.Items
+}
+
+// AddElem records the order of the next array element and merges it into
+// Items. elem may be nil when the element has no order of its own.
+func (o *KeyOrder) AddElem(elem *KeyOrder) {
+	if elem != nil && len(elem.Keys) == 0 && elem.Items == nil {
+		elem = nil // scalars don't need one
+	}
+	o.Elems = append(o.Elems, elem)
+	o.AddItem().Merge(elem)
+}
+
+// Field returns the order of the value stored under key, or nil
+func (o *KeyOrder) Field(key string) *KeyOrder {
+	if o == nil {
+		return nil
+	}
+	return o.Fields[key]
+}
+
+// Item returns the order of array elements, or nil
+func (o *KeyOrder) Item() *KeyOrder {
+	if o == nil {
+		return nil
+	}
+	return o.Items
+}
+
+// Elem returns the order of array element i, or Items when the element
+// has none of its own
+func (o *KeyOrder) Elem(i int) *KeyOrder {
+	if o == nil {
+		return nil
+	}
+	if i >= 0 && i < len(o.Elems) && o.Elems[i] != nil {
+		return o.Elems[i]
+	}
+	return o.Items
+}
+
+// OrderedKeys returns the keys of m in recorded order. Keys without a
+// recorded position follow in alphabetical order, so output is always
+// deterministic even for data built in code.
+func (o *KeyOrder) OrderedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	seen := make(map[string]bool, len(m))
+
+	if o != nil {
+		for _, key := range o.Keys {
+			if _, ok := m[key]; ok && !seen[key] {
+				seen[key] = true
+				keys = append(keys, key)
+			}
+		}
+	}
+
+	var rest []string
+	for key := range m {
+		if !seen[key] {
+			rest = append(rest, key)
+		}
+	}
+	sort.Strings(rest)
+
+	return append(keys, rest...)
+}
+
+// Merge adds the keys of other that o doesn't know yet, recursively.
+// Element orders are merged by index.
+func (o *KeyOrder) Merge(other *KeyOrder) {
+	if other == nil {
+		return
+	}
+
+	for _, key := range other.Keys {
+		o.AddKey(key).Merge(other.Fields[key])
+	}
+	if other.Items != nil {
+		o.AddItem().Merge(other.Items)
+	}
+	for i, elem := range other.Elems {
+		if i == len(o.Elems) {
+			o.Elems = append(o.Elems, nil)
+		}
+		if elem == nil {
+			continue
+		}
+		if o.Elems[i] == nil {
+			o.Elems[i] = &KeyOrder{}
+		}
+		o.Elems[i].Merge(elem)
+	}
+}
@@ -3,71 +3,111 @@
 package writers
 
 import (
+	"bufio"
 	"bytes"
+	"context"
 	"encoding/csv"
+	"encoding/json"
 	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
 	"github.com/loveucifer/aomi/pkg/converters"
 	"github.com/loveucifer/aomi/pkg/schema"
 )
 
+// ColumnOrder decides the order of columns collected from the records
+type ColumnOrder int
+
+const (
+	// FirstSeenOrder lists columns in the order records introduce them
+	FirstSeenOrder ColumnOrder = iota
+	// AlphabeticalOrder sorts columns by name
+	AlphabeticalOrder
+)
+
+// KeyPolicy decides what happens when records don't share the same keys
+type KeyPolicy int
+
+const (
+	// AllowMixedKeys silently leaves missing cells empty
+	AllowMixedKeys KeyPolicy = iota
+	// WarnMixedKeys reports mismatching records through Warn
+	WarnMixedKeys
+	// FailMixedKeys aborts writing on the first mismatching record
+	FailMixedKeys
+)
+
+// CSVOptions configures CSV output
+type CSVOptions struct {
+	Delimiter rune     // ',' if 0
+	Headers   []string // Explicit column list; collected from records if empty
+
+	SampleSize  int // Records scanned for columns (0 = all)
+	ColumnOrder ColumnOrder
+	MixedKeys   KeyPolicy
+	Warn        func(msg string) // Receives WarnMixedKeys reports
+}
+
 // CSVWriter writes documents in CSV format
 type CSVWriter struct {
-	Delimiter rune
-	Headers   []string
+	CSVOptions
+}
+
+// NewCSVWriter creates a CSV writer with the given options
+func NewCSVWriter(opts CSVOptions) *CSVWriter {
+	return &CSVWriter{CSVOptions: opts}
 }
 
-// Write converts a document to CSV bytes
-func (w *CSVWriter) Write(doc *schema.Document) ([]byte, error) {
+// Write writes a document to out as CSV
+func (w *CSVWriter) Write(ctx context.Context, out io.Writer, doc *schema.Document) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	data, err := w.encode(doc)
+	if err != nil {
+		return err
+	}
+	_, err = out.Write(data)
+	return err
+}
+
+// encode converts a document to CSV bytes
+func (w *CSVWriter) encode(doc *schema.Document) ([]byte, error) {
 	var buf bytes.Buffer
-	writer := csv.NewWriter(&buf)
-	if w.Delimiter != 0 {
-		writer.Comma = w.Delimiter
-	} // otherwise use default comma
+	writer, err := w.newCSVWriter(&buf)
+	if err != nil {
+		return nil, err
+	}
 
 	// Handle different data types
 	switch data := doc.Data.(type) {
 	case []interface{}:
 		// Array of objects - each object becomes a row
-		if len(data) == 0 {
-			// No data, just write headers if any
-			if len(w.Headers) > 0 {
-				writer.Write(w.Headers)
-			}
-		} else {
-			// Get headers from first record if not specified
-			headers := w.Headers
-			if len(headers) == 0 {
-				headers = getCSVHeaders(data[0])
-			}
-
-			// Write headers
-			writer.Write(headers)
-
-			// Write data rows
-			for _, record := range data {
-				var row []string
-				if recordMap, ok := record.(map[string]interface{}); ok {
-					for _, header := range headers {
-						value := recordMap[header]
-						row = append(row, formatCSVValue(value))
-					}
-				} else {
-					// Flatten complex structures for CSV
-					flat := converters.FlattenForCSV(record)
-					for _, header := range headers {
-						value := flat[header]
-						row = append(row, formatCSVValue(value))
-					}
-				}
-				writer.Write(row)
+		sample := w.SampleSize
+		if sample <= 0 {
+			sample = len(data) // collect the columns from every record
+		}
+		records := w.newRecordWriter(writer, sample)
+		for _, record := range data {
+			if err := records.WriteRecord(record, doc.Order.Item()); err != nil {
+				return nil, err
 			}
 		}
+		if err := records.finish(); err != nil {
+			return nil, err
+		}
 	case map[string]interface{}:
 		// Single object - flatten to single row
 		flatData := converters.FlattenForCSV(data) // Flatten nested structures for CSV compatibility
 		headers := w.Headers
 		if len(headers) == 0 {
-			headers = getMapKeys(flatData) // Get headers from flattened data
+			headers = w.collectHeaders([]interface{}{flatData}, doc.Order) // Get headers from flattened data
 		}
 
 		var row []string
@@ -94,32 +134,311 @@ func (w *CSVWriter) Write(doc *schema.Document) ([]byte, error) {
 	return buf.Bytes(), nil // :) success
 }
 
-// getCSVHeaders extracts headers from a record
-func getCSVHeaders(record interface{}) []string {
-	var headers []string
+// newCSVWriter creates an encoding/csv writer with the delimiter, which
+// must not be a quote, line break or the Unicode replacement character
+func (w *CSVWriter) newCSVWriter(out io.Writer) (*csv.Writer, error) {
+	writer := csv.NewWriter(out)
+	if w.Delimiter == 0 {
+		return writer, nil // use default comma
+	}
 
-	if recordMap, ok := record.(map[string]interface{}); ok {
-		for key := range recordMap {
-			headers = append(headers, key)
+	switch w.Delimiter {
+	case '"', '\r', '\n', utf8.RuneError:
+		return nil, fmt.Errorf("csv: invalid delimiter %q", w.Delimiter)
+	}
+	writer.Comma = w.Delimiter
+	return writer, nil
+}
+
+// Records writes records as CSV rows. Unless Headers is set, the columns
+// are collected from the first SampleSize records, which are buffered
+// until then, or from every record if SampleSize is 0: the rows are then
+// spooled to a temporary file until the input ends, so the output is the
+// same as Write's whatever the input size.
+func (w *CSVWriter) Records(ctx context.Context, out io.Writer) (RecordWriter, error) {
+	writer, err := w.newCSVWriter(out)
+	if err != nil {
+		return nil, err
+	}
+
+	records := w.newRecordWriter(writer, w.SampleSize)
+	records.ctx = ctx
+	records.spool = records.headers == nil && w.SampleSize <= 0
+	return records, nil
+}
+
+// csvRecordWriter writes records as rows, buffering (or spooling) the first
+// ones until the columns are known
+type csvRecordWriter struct {
+	ctx     context.Context
+	w       *CSVWriter
+	writer  *csv.Writer
+	sample  int
+	headers []string
+
+	pending  []interface{}    // records buffered to collect the columns
+	order    *schema.KeyOrder // merged key order of the buffered records
+	index    int
+	received int // records passed to WriteRecord
+
+	spool     bool          // spool every row to collect the columns
+	spoolFile *os.File      // rows waiting for the columns, one JSON object each
+	spoolBuf  *bufio.Writer // buffers writes to spoolFile
+	collected []string      // columns of the spooled rows, first seen first
+	seen      map[string]bool
+}
+
+// newRecordWriter starts a row stream, collecting columns from sample
+// records unless explicit headers are set
+func (w *CSVWriter) newRecordWriter(writer *csv.Writer, sample int) *csvRecordWriter {
+	records := &csvRecordWriter{
+		ctx:    context.Background(),
+		w:      w,
+		writer: writer,
+		sample: sample,
+		order:  schema.NewKeyOrder(),
+		seen:   make(map[string]bool),
+	}
+	if len(w.Headers) > 0 {
+		records.headers = w.Headers
+		writer.Write(w.Headers)
+	}
+	return records
+}
+
+func (c *csvRecordWriter) WriteRecord(record interface{}, order *schema.KeyOrder) error {
+	if err := c.ctx.Err(); err != nil {
+		return err
+	}
+
+	// A row needs columns; anything else would be written as an empty row
+	if _, ok := record.(map[string]interface{}); !ok {
+		text, _ := json.Marshal(record)
+		return fmt.Errorf("csv: record %d is not an object: %s", c.received, text)
+	}
+	c.received++
+
+	if c.headers != nil {
+		return c.writeRow(record)
+	}
+	if c.spool {
+		return c.spoolRow(record, order)
+	}
+
+	c.pending = append(c.pending, record)
+	c.order.Merge(order)
+	if len(c.pending) >= c.sample {
+		return c.flushPending()
+	}
+	return nil
+}
+
+func (c *csvRecordWriter) Close() error {
+	defer c.discard()
+	if err := c.finish(); err != nil {
+		return err
+	}
+	c.writer.Flush()
+	return c.writer.Error()
+}
+
+// finish writes the records still waiting for their columns
+func (c *csvRecordWriter) finish() error {
+	if c.spoolFile != nil {
+		return c.flushSpool()
+	}
+	if c.headers == nil && len(c.pending) > 0 {
+		return c.flushPending()
+	}
+	return nil
+}
+
+// flushPending collects the columns from the buffered records and writes
+// them with the header row
+func (c *csvRecordWriter) flushPending() error {
+	c.headers = c.w.collectHeaders(c.pending, c.order)
+	if c.headers == nil {
+		c.headers = []string{} // known, just empty
+	}
+	c.writer.Write(c.headers)
+
+	pending := c.pending
+	c.pending = nil
+	for _, record := range pending {
+		if err := c.writeRow(record); err != nil {
+			return err
 		}
-	} else {
-		// If it's not a map, flatten it first
-		flat := converters.FlattenForCSV(record)
-		for key := range flat {
-			headers = append(headers, key)
+	}
+	return nil
+}
+
+// spoolRow notes the columns of a record and saves its formatted cells
+// until every record has been seen
+func (c *csvRecordWriter) spoolRow(record interface{}, order *schema.KeyOrder) error {
+	for _, key := range getCSVHeaders(record, order) {
+		if !c.seen[key] {
+			c.seen[key] = true
+			c.collected = append(c.collected, key)
 		}
 	}
 
+	recordMap := record.(map[string]interface{})
+	cells := make(map[string]string, len(recordMap))
+	for key, value := range recordMap {
+		cells[key] = formatCSVValue(value)
+	}
+
+	if c.spoolFile == nil {
+		file, err := os.CreateTemp("", "aomi-csv-*")
+		if err != nil {
+			return fmt.Errorf("csv: spooling rows: %v", err)
+		}
+		c.spoolFile = file
+		c.spoolBuf = bufio.NewWriter(file)
+	}
+	data, err := json.Marshal(cells)
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+	if _, err := c.spoolBuf.Write(data); err != nil {
+		return fmt.Errorf("csv: spooling rows: %v", err)
+	}
+	return nil
+}
+
+// flushSpool writes the header row from the columns of every record, then
+// the spooled rows
+func (c *csvRecordWriter) flushSpool() error {
+	if err := c.spoolBuf.Flush(); err != nil {
+		return fmt.Errorf("csv: spooling rows: %v", err)
+	}
+	if _, err := c.spoolFile.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("csv: spooling rows: %v", err)
+	}
+
+	c.headers = c.collected
+	if c.headers == nil {
+		c.headers = []string{} // known, just empty
+	}
+	if c.w.ColumnOrder == AlphabeticalOrder {
+		sort.Strings(c.headers)
+	}
+	c.writer.Write(c.headers)
+
+	decoder := json.NewDecoder(bufio.NewReader(c.spoolFile))
+	for {
+		if err := c.ctx.Err(); err != nil {
+			return err
+		}
+		var cells map[string]string
+		if err := decoder.Decode(&cells); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("csv: reading spooled rows: %v", err)
+		}
+
+		record := make(map[string]interface{}, len(cells))
+		for key, cell := range cells {
+			record[key] = cell
+		}
+		if err := c.writeRow(record); err != nil {
+			return err
+		}
+	}
+}
+
+// discard removes the spool file, if any
+func (c *csvRecordWriter) discard() {
+	if c.spoolFile != nil {
+		c.spoolFile.Close()
+		os.Remove(c.spoolFile.Name())
+		c.spoolFile = nil
+	}
+}
+
+// writeRow writes one record under the columns
+func (c *csvRecordWriter) writeRow(record interface{}) error {
+	recordMap := record.(map[string]interface{})
+	if err := c.w.checkKeys(c.index, recordMap, c.headers, len(c.w.Headers) == 0); err != nil {
+		return err
+	}
+	c.index++
+
+	row := make([]string, 0, len(c.headers))
+	for _, header := range c.headers {
+		row = append(row, formatCSVValue(recordMap[header]))
+	}
+	c.writer.Write(row)
+	return nil
+}
+
+// collectHeaders builds the union of keys of the (sampled) records
+func (w *CSVWriter) collectHeaders(data []interface{}, order *schema.KeyOrder) []string {
+	sample := data
+	if w.SampleSize > 0 && len(sample) > w.SampleSize {
+		sample = sample[:w.SampleSize]
+	}
+
+	var headers []string
+	seen := make(map[string]bool)
+	for _, record := range sample {
+		for _, key := range getCSVHeaders(record, order) {
+			if !seen[key] {
+				seen[key] = true
+				headers = append(headers, key)
+			}
+		}
+	}
+
+	if w.ColumnOrder == AlphabeticalOrder {
+		sort.Strings(headers)
+	}
 	return headers
 }
 
-// getMapKeys gets all keys from a map
-func getMapKeys(m map[string]interface{}) []string {
-	var keys []string
-	for k := range m {
-		keys = append(keys, k)
+// checkKeys applies the mixed-keys policy to a record. Extra keys only
+// count when the columns were collected rather than chosen explicitly.
+func (w *CSVWriter) checkKeys(index int, record map[string]interface{}, headers []string, reportExtra bool) error {
+	if w.MixedKeys == AllowMixedKeys {
+		return nil
 	}
-	return keys
+
+	var problems []string
+	columns := make(map[string]bool, len(headers))
+	for _, header := range headers {
+		columns[header] = true
+		if _, ok := record[header]; !ok {
+			problems = append(problems, "missing "+header)
+		}
+	}
+	for _, key := range sortedKeys(record) {
+		if reportExtra && !columns[key] {
+			problems = append(problems, "extra "+key+" (dropped)")
+		}
+	}
+	if len(problems) == 0 {
+		return nil
+	}
+
+	msg := fmt.Sprintf("csv: record %d does not match the columns: %s", index, strings.Join(problems, ", "))
+	if w.MixedKeys == FailMixedKeys {
+		return fmt.Errorf("%s", msg)
+	}
+	if w.Warn != nil {
+		w.Warn(msg)
+	}
+	return nil
+}
+
+// getCSVHeaders extracts headers from a record in source key order
+func getCSVHeaders(record interface{}, order *schema.KeyOrder) []string {
+	if recordMap, ok := record.(map[string]interface{}); ok {
+		return order.OrderedKeys(recordMap)
+	}
+
+	// If it's not a map, flatten it first
+	return sortedKeys(converters.FlattenForCSV(record))
 }
 
 // formatCSVValue formats a value for CSV output
@@ -128,9 +447,13 @@ func formatCSVValue(value interface{}) string {
 	case string:
 		return v
 	case float64:
-		return fmt.Sprintf("%g", v) // :0 avoid scientific notation
+		return strconv.FormatFloat(v, 'f', -1, 64) // :0 no scientific notation
+	case json.Number:
+		return v.String() // exact digits
 	case bool:
 		return fmt.Sprintf("%t", v)
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
 	case nil:
 		return ""
 	default:
@@ -0,0 +1,58 @@
+package writers
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/loveucifer/aomi/pkg/schema"
+)
+
+func TestCSVWriterRecords(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    []interface{}
+		want    string
+		wantErr string
+	}{
+		{
+			name: "columns from every record",
+			data: []interface{}{map[string]interface{}{"a": int64(1)}, map[string]interface{}{"b": "x"}},
+			want: "a,b\n1,\n,x\n",
+		},
+		{
+			name:    "a number is not a record",
+			data:    []interface{}{int64(1), int64(2), map[string]interface{}{"a": int64(1)}},
+			wantErr: "csv: record 0 is not an object: 1",
+		},
+		{
+			name:    "an array is not a record",
+			data:    []interface{}{map[string]interface{}{"a": int64(1)}, []interface{}{int64(1), "x"}},
+			wantErr: `csv: record 1 is not an object: [1,"x"]`,
+		},
+		{
+			name:    "null is not a record",
+			data:    []interface{}{nil},
+			wantErr: "csv: record 0 is not an object: null",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out strings.Builder
+			err := NewCSVWriter(CSVOptions{}).Write(context.Background(), &out, &schema.Document{Data: tt.data})
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("Write() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Write: %v", err)
+			}
+			if got := out.String(); got != tt.want {
+				t.Errorf("Write() =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
@@ -3,29 +3,169 @@
 package writers
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
+	"io"
+	"strings"
+
 	"github.com/loveucifer/aomi/pkg/schema"
 )
 
+// JSONOptions configures JSON output
+type JSONOptions struct {
+	Indent int // Spaces per level; 0 writes compact JSON
+}
+
 // JSONWriter writes documents in JSON format
 type JSONWriter struct {
-	Indent bool
+	JSONOptions
 }
 
-// Write converts a document to JSON bytes
-func (w *JSONWriter) Write(doc *schema.Document) ([]byte, error) {
-	var result []byte
-	var err error
+// NewJSONWriter creates a JSON writer with the given options
+func NewJSONWriter(opts JSONOptions) *JSONWriter {
+	return &JSONWriter{JSONOptions: opts}
+}
 
-	if w.Indent {
-		result, err = json.MarshalIndent(doc.Data, "", "  ") // :) pretty format
-	} else {
-		result, err = json.Marshal(doc.Data) // :D compact format
+// Write writes a document to out as JSON
+func (w *JSONWriter) Write(ctx context.Context, out io.Writer, doc *schema.Document) error {
+	if err := ctx.Err(); err != nil {
+		return err
 	}
-
+	data, err := w.encode(doc)
 	if err != nil {
+		return err
+	}
+	_, err = out.Write(data)
+	return err
+}
+
+// encode converts a document to JSON bytes
+func (w *JSONWriter) encode(doc *schema.Document) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := writeOrderedJSON(&buf, doc.Data, doc.Order); err != nil {
 		return nil, err // :0 marshaling failed
 	}
 
-	return result, nil
+	if w.Indent <= 0 {
+		return buf.Bytes(), nil // :D compact format
+	}
+
+	var pretty bytes.Buffer
+	if err := json.Indent(&pretty, buf.Bytes(), "", w.indent()); err != nil { // :) pretty format
+		return nil, err
+	}
+	return pretty.Bytes(), nil
+}
+
+// Records writes records as the elements of a JSON array, producing the
+// same output as Write does for the whole array
+func (w *JSONWriter) Records(ctx context.Context, out io.Writer) (RecordWriter, error) {
+	return &jsonRecordWriter{ctx: ctx, out: out, indent: w.indent()}, nil
+}
+
+// indent returns the indentation of one level, "" for compact output
+func (w *JSONWriter) indent() string {
+	if w.Indent <= 0 {
+		return ""
+	}
+	return strings.Repeat(" ", w.Indent)
+}
+
+// jsonRecordWriter writes array elements as they arrive
+type jsonRecordWriter struct {
+	ctx    context.Context
+	out    io.Writer
+	indent string // "" for compact output
+	count  int
+}
+
+func (j *jsonRecordWriter) WriteRecord(record interface{}, order *schema.KeyOrder) error {
+	if err := j.ctx.Err(); err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	switch {
+	case j.count == 0:
+		buf.WriteString("[")
+	default:
+		buf.WriteString(",")
+	}
+	if j.indent != "" {
+		buf.WriteString("\n" + j.indent)
+	}
+
+	var element bytes.Buffer
+	if err := writeOrderedJSON(&element, record, order); err != nil {
+		return err // :0 marshaling failed
+	}
+	if j.indent != "" {
+		if err := json.Indent(&buf, element.Bytes(), j.indent, j.indent); err != nil {
+			return err
+		}
+	} else {
+		buf.Write(element.Bytes())
+	}
+
+	j.count++
+	_, err := j.out.Write(buf.Bytes())
+	return err
+}
+
+func (j *jsonRecordWriter) Close() error {
+	closing := "]"
+	switch {
+	case j.count == 0:
+		closing = "[]"
+	case j.indent != "":
+		closing = "\n]"
+	}
+	_, err := io.WriteString(j.out, closing)
+	return err
+}
+
+// writeOrderedJSON encodes a value compactly, writing object keys in the
+// recorded source order
+func writeOrderedJSON(buf *bytes.Buffer, value interface{}, order *schema.KeyOrder) error {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		buf.WriteByte('{')
+		for i, key := range order.OrderedKeys(v) {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			encodedKey, err := json.Marshal(key)
+			if err != nil {
+				return err
+			}
+			buf.Write(encodedKey)
+			buf.WriteByte(':')
+			if err := writeOrderedJSON(buf, v[key], order.Field(key)); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte('}')
+	case []interface{}:
+		buf.WriteByte('[')
+		for i, item := range v {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := writeOrderedJSON(buf, item, order.Elem(i)); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte(']')
+	default:
+		encoded, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		buf.Write(encoded)
+		if _, ok := v.(float64); ok && !bytes.ContainsAny(encoded, ".eE") {
+			buf.WriteString(".0") // keep whole floats floats
+		}
+	}
+	return nil
 }
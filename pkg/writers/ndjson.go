@@ -0,0 +1,87 @@
+// Package writers provides format-specific writing for Aomi
+// NDJSON / JSON Lines writer: one record per line :D
+package writers
+
+import (
+	"bytes"
+	"context"
+	"io"
+
+	"github.com/loveucifer/aomi/pkg/schema"
+)
+
+// NDJSONWriter writes documents as newline-delimited JSON (JSON Lines).
+// Each element of an array is written compactly on its own line; any other
+// document is written as a single line.
+type NDJSONWriter struct{}
+
+// Write writes a document to out as NDJSON
+func (w *NDJSONWriter) Write(ctx context.Context, out io.Writer, doc *schema.Document) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	data, err := w.encode(doc)
+	if err != nil {
+		return err
+	}
+	_, err = out.Write(data)
+	return err
+}
+
+// encode converts a document to NDJSON bytes
+func (w *NDJSONWriter) encode(doc *schema.Document) ([]byte, error) {
+	var buf bytes.Buffer
+
+	items, ok := doc.Data.([]interface{})
+	if !ok {
+		if err := writeNDJSONLine(&buf, doc.Data, doc.Order); err != nil {
+			return nil, err // :0 marshaling failed
+		}
+		return buf.Bytes(), nil
+	}
+
+	for i, item := range items {
+		if err := writeNDJSONLine(&buf, item, doc.Order.Elem(i)); err != nil {
+			return nil, err // :0 marshaling failed
+		}
+	}
+	return buf.Bytes(), nil // :) success
+}
+
+// Records writes each record as a line
+func (w *NDJSONWriter) Records(ctx context.Context, out io.Writer) (RecordWriter, error) {
+	return &ndjsonRecordWriter{ctx: ctx, out: out}, nil
+}
+
+// ndjsonRecordWriter writes a line per record as they arrive
+type ndjsonRecordWriter struct {
+	ctx context.Context
+	out io.Writer
+}
+
+func (n *ndjsonRecordWriter) WriteRecord(record interface{}, order *schema.KeyOrder) error {
+	if err := n.ctx.Err(); err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	if err := writeNDJSONLine(&buf, record, order); err != nil {
+		return err // :0 marshaling failed
+	}
+	_, err := n.out.Write(buf.Bytes())
+	return err
+}
+
+// Close has nothing to finish: every line is complete
+func (n *ndjsonRecordWriter) Close() error {
+	return nil
+}
+
+// writeNDJSONLine writes a value as compact JSON followed by a newline
+func writeNDJSONLine(buf *bytes.Buffer, value interface{}, order *schema.KeyOrder) error {
+	if err := writeOrderedJSON(buf, value, order); err != nil {
+		return err
+	}
+	buf.WriteByte('\n')
+	return nil
+}
@@ -0,0 +1,40 @@
+// Package writers provides format-specific writing for Aomi
+// Record streams for outputs larger than memory :0
+package writers
+
+import (
+	"context"
+	"io"
+
+	"github.com/loveucifer/aomi/pkg/schema"
+)
+
+// RecordWriter writes a stream of records one at a time
+type RecordWriter interface {
+	WriteRecord(record interface{}, order *schema.KeyOrder) error
+	// Close finishes the output (closing brackets, buffered rows); it
+	// doesn't close the underlying io.Writer
+	Close() error
+}
+
+// Discard releases what a record writer holds, such as a CSV spool file,
+// when the stream is abandoned before Close; it is a no-op after Close
+func Discard(w RecordWriter) {
+	if d, ok := w.(interface{ discard() }); ok {
+		d.discard()
+	}
+}
+
+// StreamingWriter is a Writer that can also write a stream of records, the
+// way Write would write them as a top-level array
+type StreamingWriter interface {
+	Writer
+	Records(ctx context.Context, out io.Writer) (RecordWriter, error)
+}
+
+// Built-in writers that stream
+var (
+	_ StreamingWriter = (*JSONWriter)(nil)
+	_ StreamingWriter = (*CSVWriter)(nil)
+	_ StreamingWriter = (*NDJSONWriter)(nil)
+)
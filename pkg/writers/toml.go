@@ -3,19 +3,458 @@
 package writers
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
 	"github.com/loveucifer/aomi/pkg/schema"
-	"github.com/pelletier/go-toml/v2"
 )
 
+// NullPolicy decides how nulls are written in TOML, which has no null
+type NullPolicy int
+
+const (
+	// OmitNulls leaves out null values, both keys and array elements
+	OmitNulls NullPolicy = iota
+	// SentinelNulls writes NullSentinel as a string in place of nulls
+	SentinelNulls
+	// FailNulls aborts writing on the first null
+	FailNulls
+)
+
+// DefaultTOMLRootKey holds the root of documents that aren't a table
+const DefaultTOMLRootKey = "records"
+
+// TOMLOptions configures TOML output
+type TOMLOptions struct {
+	// InlineTables writes nested tables as inline tables ({ k = v }) and
+	// arrays of tables as arrays of inline tables, instead of [sections]
+	InlineTables bool
+
+	// RootKey is the key a root that isn't a table, such as the records
+	// of a CSV file, is written under ([[records]] if empty)
+	RootKey string
+
+	Nulls        NullPolicy
+	NullSentinel string // Written for nulls under SentinelNulls
+
+	// Datetimes writes strings holding an RFC 3339 date-time, a date or a
+	// time of day as native TOML values, e.g. after a trip through JSON
+	Datetimes bool
+}
+
 // TOMLWriter writes documents in TOML format
-type TOMLWriter struct{}
+type TOMLWriter struct {
+	TOMLOptions
+}
 
-// Write converts a document to TOML bytes
-func (w *TOMLWriter) Write(doc *schema.Document) ([]byte, error) {
-	result, err := toml.Marshal(doc.Data) // :D preserve native types
+// NewTOMLWriter creates a TOML writer with the given options
+func NewTOMLWriter(opts TOMLOptions) *TOMLWriter {
+	return &TOMLWriter{TOMLOptions: opts}
+}
+
+// Write writes a document to out as TOML
+func (w *TOMLWriter) Write(ctx context.Context, out io.Writer, doc *schema.Document) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	data, err := w.encode(doc)
 	if err != nil {
+		return err
+	}
+	_, err = out.Write(data)
+	return err
+}
+
+// encode converts a document to TOML bytes. A root that isn't a table is
+// written under RootKey, so an array of records becomes [[records]].
+func (w *TOMLWriter) encode(doc *schema.Document) ([]byte, error) {
+	data, order := doc.Data, doc.Order
+	if _, ok := data.(map[string]interface{}); !ok {
+		key := w.RootKey
+		if key == "" {
+			key = DefaultTOMLRootKey
+		}
+		data = map[string]interface{}{key: data}
+		order = schema.NewKeyOrder(key)
+		order.Fields[key] = doc.Order
+	}
+
+	root, _, err := w.replaceNulls(data, "")
+	if err != nil {
+		return nil, err
+	}
+
+	enc := &tomlEncoder{inline: w.InlineTables, datetimes: w.Datetimes}
+	if err := enc.writeTable(nil, "", root.(map[string]interface{}), order); err != nil {
 		return nil, err // :0 marshaling failed
 	}
 
-	return result, nil // :) success
+	return enc.buf.Bytes(), nil // :) success
+}
+
+// replaceNulls applies the null policy to a value and everything in it.
+// keep is false if the value itself is a null to leave out.
+func (w *TOMLWriter) replaceNulls(value interface{}, path string) (interface{}, bool, error) {
+	switch v := value.(type) {
+	case nil:
+		switch w.Nulls {
+		case SentinelNulls:
+			return w.NullSentinel, true, nil
+		case FailNulls:
+			return nil, false, tomlError(path, "null can't be written to TOML")
+		default:
+			return nil, false, nil
+		}
+	case map[string]interface{}:
+		table := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			replaced, keep, err := w.replaceNulls(item, tomlPathKey(path, key))
+			if err != nil {
+				return nil, false, err
+			}
+			if keep {
+				table[key] = replaced
+			}
+		}
+		return table, true, nil
+	case []interface{}:
+		arr := make([]interface{}, 0, len(v))
+		for i, item := range v {
+			replaced, keep, err := w.replaceNulls(item, tomlPathIndex(path, i))
+			if err != nil {
+				return nil, false, err
+			}
+			if keep {
+				arr = append(arr, replaced)
+			}
+		}
+		return arr, true, nil
+	default:
+		return value, true, nil
+	}
+}
+
+// tomlEncoder emits TOML by hand so that keys follow the document order;
+// toml.Marshal always sorts map keys
+type tomlEncoder struct {
+	buf       bytes.Buffer
+	inline    bool // every table below the root is written inline
+	datetimes bool // date and time strings are written as TOML values
+}
+
+// writeTable writes the key/values of a table, then its sub-tables and
+// arrays of tables (TOML requires plain keys to come first). header is the
+// table's key path and path its location for errors, e.g. records[2].
+func (e *tomlEncoder) writeTable(header []string, path string, table map[string]interface{}, order *schema.KeyOrder) error {
+	keys := order.OrderedKeys(table)
+
+	for _, key := range keys {
+		value := table[key]
+		if !e.inline && (isTOMLTable(value) || isTOMLArrayOfTables(value)) {
+			continue // tables are written below
+		}
+		keyPath := tomlPathKey(path, key)
+		if err := checkTOMLKey(key, keyPath); err != nil {
+			return err
+		}
+		e.buf.WriteString(tomlKey(key))
+		e.buf.WriteString(" = ")
+		if err := e.writeValue(value, keyPath, order.Field(key)); err != nil {
+			return err
+		}
+		e.buf.WriteString("\n")
+	}
+
+	if e.inline {
+		return nil
+	}
+
+	for _, key := range keys {
+		childHeader := append(append([]string{}, header...), key)
+		keyPath := tomlPathKey(path, key)
+
+		switch value := table[key].(type) {
+		case map[string]interface{}:
+			if err := checkTOMLKey(key, keyPath); err != nil {
+				return err
+			}
+			e.writeHeader("[", childHeader, "]")
+			if err := e.writeTable(childHeader, keyPath, value, order.Field(key)); err != nil {
+				return err
+			}
+		case []interface{}:
+			if !isTOMLArrayOfTables(value) {
+				continue
+			}
+			if err := checkTOMLKey(key, keyPath); err != nil {
+				return err
+			}
+			for i, item := range value {
+				e.writeHeader("[[", childHeader, "]]")
+				if err := e.writeTable(childHeader, tomlPathIndex(keyPath, i), item.(map[string]interface{}), order.Field(key).Elem(i)); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// writeHeader writes a [table] or [[array]] header line
+func (e *tomlEncoder) writeHeader(open string, path []string, close string) {
+	if e.buf.Len() > 0 {
+		e.buf.WriteString("\n")
+	}
+
+	quoted := make([]string, len(path))
+	for i, key := range path {
+		quoted[i] = tomlKey(key)
+	}
+	e.buf.WriteString(open + strings.Join(quoted, ".") + close + "\n")
+}
+
+// writeValue writes an inline value: scalar, array or inline table
+func (e *tomlEncoder) writeValue(value interface{}, path string, order *schema.KeyOrder) error {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		e.buf.WriteString("{")
+		first := true
+		for _, key := range order.OrderedKeys(v) {
+			keyPath := tomlPathKey(path, key)
+			if err := checkTOMLKey(key, keyPath); err != nil {
+				return err
+			}
+			if !first {
+				e.buf.WriteString(",")
+			}
+			first = false
+			e.buf.WriteString(" " + tomlKey(key) + " = ")
+			if err := e.writeValue(v[key], keyPath, order.Field(key)); err != nil {
+				return err
+			}
+		}
+		if !first {
+			e.buf.WriteString(" ")
+		}
+		e.buf.WriteString("}")
+	case []interface{}:
+		e.buf.WriteString("[")
+		for i, item := range v {
+			if i > 0 {
+				e.buf.WriteString(", ")
+			}
+			if err := e.writeValue(item, tomlPathIndex(path, i), order.Elem(i)); err != nil {
+				return err
+			}
+		}
+		e.buf.WriteString("]")
+	default:
+		if s, ok := v.(string); ok && e.datetimes {
+			if datetime, ok := tomlDatetime(s); ok {
+				value = datetime
+			}
+		}
+		scalar, err := tomlScalar(value)
+		if err != nil {
+			return tomlError(path, "%v", err)
+		}
+		e.buf.WriteString(scalar)
+	}
+	return nil
+}
+
+// tomlDatetime reads a string as an RFC 3339 date-time, a local date-time,
+// a date or a time of day
+func tomlDatetime(s string) (interface{}, bool) {
+	if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+		return t, true
+	}
+	var local schema.LocalDateTime
+	if err := local.UnmarshalText([]byte(s)); err == nil {
+		return local, true
+	}
+	var date schema.LocalDate
+	if err := date.UnmarshalText([]byte(s)); err == nil {
+		return date, true
+	}
+	var clock schema.LocalTime
+	if err := clock.UnmarshalText([]byte(s)); err == nil {
+		return clock, true
+	}
+	return nil, false
+}
+
+// tomlScalar formats a scalar value as a TOML literal
+func tomlScalar(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case nil:
+		return "", fmt.Errorf("null can't be written to TOML")
+	case string:
+		if !utf8.ValidString(v) {
+			return "", fmt.Errorf("string is not valid UTF-8")
+		}
+		return tomlString(v), nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case int:
+		return strconv.Itoa(v), nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	case uint64:
+		if v > math.MaxInt64 {
+			return "", fmt.Errorf("integer %d is larger than TOML's 64-bit integers", v)
+		}
+		return strconv.FormatUint(v, 10), nil
+	case float64:
+		return tomlFloat(v), nil
+	case json.Number:
+		return tomlNumber(v)
+	case time.Time:
+		return v.Format(time.RFC3339Nano), nil
+	case schema.LocalDate:
+		return v.String(), nil
+	case schema.LocalTime:
+		return v.String(), nil
+	case schema.LocalDateTime:
+		return v.String(), nil
+	default:
+		return "", fmt.Errorf("%T values can't be written to TOML", value)
+	}
+}
+
+// checkTOMLKey rejects keys TOML can't hold
+func checkTOMLKey(key, path string) error {
+	if !utf8.ValidString(key) {
+		return tomlError(path, "key is not valid UTF-8")
+	}
+	return nil
+}
+
+// tomlError reports a value that can't be written, with its path
+func tomlError(path, format string, args ...interface{}) error {
+	if path == "" {
+		path = "document root"
+	}
+	return fmt.Errorf("toml: %s: %s", path, fmt.Sprintf(format, args...))
+}
+
+// tomlPathKey and tomlPathIndex build the paths shown in errors, such as
+// records[2].address.city
+func tomlPathKey(path, key string) string {
+	if path == "" {
+		return tomlKey(key)
+	}
+	return path + "." + tomlKey(key)
+}
+
+func tomlPathIndex(path string, i int) string {
+	return fmt.Sprintf("%s[%d]", path, i)
+}
+
+// tomlNumber writes an exact number verbatim; JSON number syntax is valid
+// TOML, but TOML integers are limited to 64 bits
+func tomlNumber(num json.Number) (string, error) {
+	text := num.String()
+	if !strings.ContainsAny(text, ".eE") {
+		if _, err := strconv.ParseInt(text, 10, 64); err != nil {
+			return "", fmt.Errorf("integer %s is larger than TOML's 64-bit integers", text)
+		}
+	}
+	return text, nil
+}
+
+// tomlFloat formats a float so it always reads back as a TOML float
+func tomlFloat(f float64) string {
+	switch {
+	case math.IsNaN(f):
+		return "nan"
+	case math.IsInf(f, 1):
+		return "inf"
+	case math.IsInf(f, -1):
+		return "-inf"
+	}
+
+	abs := math.Abs(f)
+	if abs != 0 && (abs < 1e-6 || abs >= 1e21) {
+		return strconv.FormatFloat(f, 'e', -1, 64)
+	}
+	s := strconv.FormatFloat(f, 'f', -1, 64)
+	if !strings.Contains(s, ".") {
+		s += ".0"
+	}
+	return s
+}
+
+// tomlString quotes a string as a TOML basic string
+func tomlString(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for _, r := range s {
+		switch r {
+		case '"':
+			b.WriteString(`\"`)
+		case '\\':
+			b.WriteString(`\\`)
+		case '\b':
+			b.WriteString(`\b`)
+		case '\t':
+			b.WriteString(`\t`)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\f':
+			b.WriteString(`\f`)
+		case '\r':
+			b.WriteString(`\r`)
+		default:
+			if r < 0x20 || r == 0x7f {
+				fmt.Fprintf(&b, `\u%04X`, r)
+			} else {
+				b.WriteRune(r)
+			}
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+// tomlKey returns a bare key when possible, a quoted key otherwise
+func tomlKey(key string) string {
+	if key == "" {
+		return `""`
+	}
+	for _, r := range key {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' || r == '-') {
+			return tomlString(key)
+		}
+	}
+	return key
+}
+
+// isTOMLTable reports whether a value is written as a [table]
+func isTOMLTable(value interface{}) bool {
+	_, ok := value.(map[string]interface{})
+	return ok
+}
+
+// isTOMLArrayOfTables reports whether a value is written as [[tables]]
+func isTOMLArrayOfTables(value interface{}) bool {
+	arr, ok := value.([]interface{})
+	if !ok || len(arr) == 0 {
+		return false
+	}
+	for _, item := range arr {
+		if _, ok := item.(map[string]interface{}); !ok {
+			return false
+		}
+	}
+	return true
 }
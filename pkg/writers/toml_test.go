@@ -0,0 +1,112 @@
+package writers
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/loveucifer/aomi/pkg/schema"
+)
+
+func TestTOMLWriter(t *testing.T) {
+	records := []interface{}{
+		map[string]interface{}{"a": int64(1), "b": nil},
+		map[string]interface{}{"a": nil, "b": "x"},
+	}
+
+	tests := []struct {
+		name    string
+		opts    TOMLOptions
+		data    interface{}
+		want    string
+		wantErr string
+	}{
+		{
+			name: "records go under the default root key",
+			data: []interface{}{map[string]interface{}{"a": int64(1)}, map[string]interface{}{"a": int64(2)}},
+			want: "[[records]]\na = 1\n\n[[records]]\na = 2\n",
+		},
+		{
+			name: "custom root key",
+			opts: TOMLOptions{RootKey: "rows"},
+			data: []interface{}{map[string]interface{}{"a": int64(1)}},
+			want: "[[rows]]\na = 1\n",
+		},
+		{
+			name: "omit nulls drops keys and array elements",
+			data: map[string]interface{}{"a": nil, "b": []interface{}{int64(1), nil, int64(2)}},
+			want: "b = [1, 2]\n",
+		},
+		{
+			name: "sentinel nulls",
+			opts: TOMLOptions{Nulls: SentinelNulls, NullSentinel: "NULL"},
+			data: records,
+			want: "[[records]]\na = 1\nb = \"NULL\"\n\n[[records]]\na = \"NULL\"\nb = \"x\"\n",
+		},
+		{
+			name:    "fail on nulls names the path",
+			opts:    TOMLOptions{Nulls: FailNulls},
+			data:    records,
+			wantErr: "toml: records[0].b: null can't be written to TOML",
+		},
+		{
+			name:    "fail on a null root",
+			opts:    TOMLOptions{Nulls: FailNulls, RootKey: "value"},
+			data:    nil,
+			wantErr: "toml: value: null can't be written to TOML",
+		},
+		{
+			name:    "quoted keys in paths",
+			opts:    TOMLOptions{Nulls: FailNulls},
+			data:    map[string]interface{}{"a b": map[string]interface{}{"c": nil}},
+			wantErr: `toml: "a b".c: null can't be written to TOML`,
+		},
+		{
+			name:    "integers beyond 64 bits",
+			data:    map[string]interface{}{"items": []interface{}{json.Number("12345678901234567890")}},
+			wantErr: "toml: items[0]: integer 12345678901234567890 is larger than TOML's 64-bit integers",
+		},
+		{
+			name:    "unsigned integers beyond 64 bits",
+			data:    map[string]interface{}{"n": uint64(1 << 63)},
+			wantErr: "toml: n: integer 9223372036854775808 is larger than TOML's 64-bit integers",
+		},
+		{
+			name: "date and time strings as TOML values",
+			opts: TOMLOptions{Datetimes: true},
+			data: map[string]interface{}{"d": "1979-05-27", "t": "07:32:00.999", "dt": "1979-05-27 07:32:00"},
+			want: "d = 1979-05-27\ndt = 1979-05-27T07:32:00\nt = 07:32:00.999\n",
+		},
+		{
+			name: "times finer than a nanosecond stay strings",
+			opts: TOMLOptions{Datetimes: true},
+			data: map[string]interface{}{"t": "07:32:00.1234567891"},
+			want: "t = \"07:32:00.1234567891\"\n",
+		},
+		{
+			name: "exact numbers and whole floats",
+			data: map[string]interface{}{"price": json.Number("19.90"), "n": 1.0},
+			want: "n = 1.0\nprice = 19.90\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out strings.Builder
+			err := NewTOMLWriter(tt.opts).Write(context.Background(), &out, &schema.Document{Data: tt.data})
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("Write() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Write: %v", err)
+			}
+			if got := out.String(); got != tt.want {
+				t.Errorf("Write() =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
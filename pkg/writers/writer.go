@@ -0,0 +1,36 @@
+// Package writers provides format-specific writing for Aomi
+// The Writer interface every format implements :)
+package writers
+
+import (
+	"bytes"
+	"context"
+	"io"
+
+	"github.com/loveucifer/aomi/pkg/schema"
+)
+
+// Writer writes a document to a stream. Format options (indentation,
+// columns, root tags, ...) are fields of the implementing type.
+type Writer interface {
+	Write(ctx context.Context, out io.Writer, doc *schema.Document) error
+}
+
+// Every built-in writer implements Writer
+var (
+	_ Writer = (*JSONWriter)(nil)
+	_ Writer = (*CSVWriter)(nil)
+	_ Writer = (*YAMLWriter)(nil)
+	_ Writer = (*XMLWriter)(nil)
+	_ Writer = (*TOMLWriter)(nil)
+	_ Writer = (*NDJSONWriter)(nil)
+)
+
+// Marshal writes a document with w and returns the output bytes
+func Marshal(w Writer, doc *schema.Document) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := w.Write(context.Background(), &buf, doc); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -3,88 +3,248 @@
 package writers
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
 	"fmt"
-	"github.com/loveucifer/aomi/pkg/schema"
+	"io"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
+	"unicode"
+
+	"github.com/loveucifer/aomi/pkg/schema"
 )
 
 // XMLWriter writes documents in XML format
+//
+// It is the inverse of parsers.XMLParser: keys starting with AttrPrefix
+// become attributes, TextKey becomes character data and arrays repeat
+// their parent's tag, so XML -> JSON -> XML keeps the original shape.
 type XMLWriter struct {
-	RootTag string
+	XMLOptions
+}
+
+// XMLOptions configures XML output
+type XMLOptions struct {
+	RootTag    string // Root element used when the data has no single root ("root")
+	ItemTag    string // Element name for items of arrays without a parent key ("item")
+	AttrPrefix string // Prefix of keys written as attributes ("@")
+	TextKey    string // Key written as element text ("#text")
 }
 
-// Write converts a document to XML bytes
-func (w *XMLWriter) Write(doc *schema.Document) ([]byte, error) {
+// NewXMLWriter creates an XML writer with the given options
+func NewXMLWriter(opts XMLOptions) *XMLWriter {
+	return &XMLWriter{XMLOptions: opts}
+}
+
+// Write writes a document to out as XML
+func (w *XMLWriter) Write(ctx context.Context, out io.Writer, doc *schema.Document) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	data, err := w.encode(doc)
+	if err != nil {
+		return err
+	}
+	_, err = out.Write(data)
+	return err
+}
+
+// encode converts a document to XML bytes
+func (w *XMLWriter) encode(doc *schema.Document) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+
+	encoder := xml.NewEncoder(&buf)
+	encoder.Indent("", "  ") // :D indented XML
+
+	rootTag, rootValue, rootOrder := w.root(doc.Data, doc.Order)
+	if err := w.writeElement(encoder, rootTag, rootValue, rootOrder); err != nil {
+		return nil, err // :0 encoding failed
+	}
+	if err := encoder.Flush(); err != nil {
+		return nil, err
+	}
+	buf.WriteString("\n")
+
+	return buf.Bytes(), nil // :) success
+}
+
+// root picks the root element name and content for the document data
+func (w *XMLWriter) root(data interface{}, order *schema.KeyOrder) (string, interface{}, *schema.KeyOrder) {
 	rootTag := w.RootTag
 	if rootTag == "" {
 		rootTag = "root" // :D default root element
 	}
 
-	var result strings.Builder
-	result.WriteString("<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n")
-	result.WriteString(fmt.Sprintf("<%s>\n", rootTag))
-
-	// Convert the document data to XML
-	xmlContent := convertToXML(doc.Data, "  ") // :D indented XML
-	result.WriteString(xmlContent)
-
-	result.WriteString(fmt.Sprintf("</%s>\n", rootTag))
+	// A map with one element child (as produced by the XML parser) is
+	// already rooted; arrays can't be a root since they repeat the tag
+	if m, ok := data.(map[string]interface{}); ok && len(m) == 1 {
+		for key, value := range m {
+			if _, isArray := value.([]interface{}); !isArray && !w.isSpecialKey(key) {
+				return key, value, order.Field(key)
+			}
+		}
+	}
 
-	return []byte(result.String()), nil // :) success
+	return rootTag, data, order
 }
 
-// convertToXML converts data to XML string representation
-func convertToXML(data interface{}, indent string) string {
-	var result strings.Builder
+// writeElement writes a single element and its content
+func (w *XMLWriter) writeElement(enc *xml.Encoder, name string, value interface{}, order *schema.KeyOrder) error {
+	start := xml.StartElement{Name: xml.Name{Local: sanitizeXMLName(name)}}
 
-	switch v := data.(type) {
+	switch v := value.(type) {
 	case map[string]interface{}:
-		for key, value := range v {
-			result.WriteString(indent)
-			result.WriteString(fmt.Sprintf("<%s>", key))
-
-			switch val := value.(type) {
-			case map[string]interface{}:
-				result.WriteString("\n")
-				result.WriteString(convertToXML(val, indent+"  ")) // :D nested indent
-				result.WriteString(indent)
-				result.WriteString(fmt.Sprintf("</%s>\n", key))
-			case []interface{}:
-				result.WriteString("\n")
-				for _, item := range val {
-					result.WriteString(indent + "  ")
-					result.WriteString(fmt.Sprintf("<%s_item>", key)) // :D array items
-					result.WriteString(fmt.Sprintf("%v", item))
-					result.WriteString(fmt.Sprintf("</%s_item>\n", key))
-				}
-				result.WriteString(indent)
-				result.WriteString(fmt.Sprintf("</%s>\n", key))
+		// Text and children are written in key order, so text that came
+		// after a child stays after it
+		attrPrefix := w.attrPrefix()
+		var content []string
+		for _, key := range order.OrderedKeys(v) {
+			switch {
+			case strings.HasPrefix(key, attrPrefix) && len(key) > len(attrPrefix) && key != w.textKey():
+				start.Attr = append(start.Attr, xml.Attr{
+					Name:  xml.Name{Local: sanitizeXMLName(strings.TrimPrefix(key, attrPrefix))},
+					Value: formatXMLValue(v[key]),
+				})
 			default:
-				result.WriteString(fmt.Sprintf("%v", val))
-				result.WriteString(fmt.Sprintf("</%s>\n", key))
+				content = append(content, key)
+			}
+		}
+
+		if err := enc.EncodeToken(start); err != nil {
+			return err
+		}
+		for _, key := range content {
+			if key == w.textKey() {
+				if text := formatXMLValue(v[key]); text != "" {
+					if err := enc.EncodeToken(xml.CharData(text)); err != nil {
+						return err
+					}
+				}
+				continue
+			}
+			if err := w.writeChild(enc, key, v[key], order.Field(key)); err != nil {
+				return err
 			}
 		}
 	case []interface{}:
+		// Array without a parent key (root or nested array): wrap items
+		if err := enc.EncodeToken(start); err != nil {
+			return err
+		}
 		for i, item := range v {
-			itemTag := fmt.Sprintf("item_%d", i)
-			result.WriteString(indent)
-			result.WriteString(fmt.Sprintf("<%s>", itemTag))
-
-			switch val := item.(type) {
-			case map[string]interface{}:
-				result.WriteString("\n")
-				result.WriteString(convertToXML(val, indent+"  "))
-				result.WriteString(indent)
-				result.WriteString(fmt.Sprintf("</%s>\n", itemTag))
-			default:
-				result.WriteString(fmt.Sprintf("%v", val))
-				result.WriteString(fmt.Sprintf("</%s>\n", itemTag))
+			if err := w.writeElement(enc, w.itemTag(), item, order.Elem(i)); err != nil {
+				return err
 			}
 		}
 	default:
-		result.WriteString(indent)
-		result.WriteString(fmt.Sprintf("%v\n", v)) // :D simple value
+		if err := enc.EncodeToken(start); err != nil {
+			return err
+		}
+		if text := formatXMLValue(v); text != "" {
+			if err := enc.EncodeToken(xml.CharData(text)); err != nil {
+				return err
+			}
+		}
 	}
 
-	return result.String()
+	return enc.EncodeToken(start.End())
+}
+
+// writeChild writes a map entry, repeating the tag for array values
+func (w *XMLWriter) writeChild(enc *xml.Encoder, key string, value interface{}, order *schema.KeyOrder) error {
+	items, ok := value.([]interface{})
+	if !ok {
+		return w.writeElement(enc, key, value, order)
+	}
+
+	for i, item := range items {
+		if err := w.writeElement(enc, key, item, order.Elem(i)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// isSpecialKey reports whether a key maps to an attribute or text content
+func (w *XMLWriter) isSpecialKey(key string) bool {
+	return key == w.textKey() || strings.HasPrefix(key, w.attrPrefix())
+}
+
+func (w *XMLWriter) attrPrefix() string {
+	if w.AttrPrefix == "" {
+		return "@"
+	}
+	return w.AttrPrefix
+}
+
+func (w *XMLWriter) textKey() string {
+	if w.TextKey == "" {
+		return "#text"
+	}
+	return w.TextKey
+}
+
+func (w *XMLWriter) itemTag() string {
+	if w.ItemTag == "" {
+		return "item"
+	}
+	return w.ItemTag
+}
+
+// sanitizeXMLName turns an arbitrary key into a valid XML element name
+func sanitizeXMLName(name string) string {
+	var b strings.Builder
+	for i, r := range name {
+		switch {
+		case unicode.IsLetter(r) || r == '_' || r == ':':
+			b.WriteRune(r)
+		case unicode.IsDigit(r) || r == '-' || r == '.':
+			if i == 0 {
+				b.WriteRune('_') // names can't start with a digit, '-' or '.'
+			}
+			b.WriteRune(r)
+		default:
+			b.WriteRune('_') // spaces and punctuation :0
+		}
+	}
+
+	if b.Len() == 0 {
+		return "_"
+	}
+	return b.String()
+}
+
+// sortedKeys returns the keys of a map in a stable order
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// formatXMLValue formats a scalar for use as text or attribute value
+func formatXMLValue(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case json.Number:
+		return v.String()
+	case bool:
+		return strconv.FormatBool(v)
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	default:
+		return fmt.Sprintf("%v", v)
+	}
 }
@@ -0,0 +1,81 @@
+package writers
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/loveucifer/aomi/pkg/schema"
+)
+
+func TestXMLWriter(t *testing.T) {
+	tests := []struct {
+		name  string
+		opts  XMLOptions
+		data  interface{}
+		order *schema.KeyOrder
+		want  string
+	}{
+		{
+			name: "attributes and text",
+			data: map[string]interface{}{"price": map[string]interface{}{"@currency": "EUR", "#text": "9.50"}},
+			want: `<price currency="EUR">9.50</price>`,
+		},
+		{
+			name: "repeated tags for arrays",
+			data: map[string]interface{}{"list": map[string]interface{}{"item": []interface{}{"a", "b"}}},
+			want: "<list>\n  <item>a</item>\n  <item>b</item>\n</list>",
+		},
+		{
+			name: "values and attributes are escaped",
+			data: map[string]interface{}{"note": map[string]interface{}{"@title": `"a" & b`, "body": "1 < 2 & 3 > 2"}},
+			want: "<note title=\"&#34;a&#34; &amp; b\">\n  <body>1 &lt; 2 &amp; 3 &gt; 2</body>\n</note>",
+		},
+		{
+			name: "invalid names are sanitized",
+			data: map[string]interface{}{"root": map[string]interface{}{"first name": "Ann", "1st": "x"}},
+			want: "<root>\n  <_1st>x</_1st>\n  <first_name>Ann</first_name>\n</root>",
+		},
+		{
+			name:  "text keeps its place among the children",
+			data:  map[string]interface{}{"p": map[string]interface{}{"b": "world", "#text": "again"}},
+			order: textAfterChild(),
+			want:  "<p>\n  <b>world</b>again\n</p>",
+		},
+		{
+			name: "records under the root and item tags",
+			opts: XMLOptions{RootTag: "rows", ItemTag: "row"},
+			data: []interface{}{map[string]interface{}{"a": int64(1)}, map[string]interface{}{"a": int64(2)}},
+			want: "<rows>\n  <row>\n    <a>1</a>\n  </row>\n  <row>\n    <a>2</a>\n  </row>\n</rows>",
+		},
+		{
+			name: "custom attribute prefix and text key",
+			opts: XMLOptions{AttrPrefix: "-", TextKey: "_"},
+			data: map[string]interface{}{"a": map[string]interface{}{"-id": "1", "_": "x"}},
+			want: `<a id="1">x</a>`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out strings.Builder
+			err := NewXMLWriter(tt.opts).Write(context.Background(), &out, &schema.Document{Data: tt.data, Order: tt.order})
+			if err != nil {
+				t.Fatalf("Write: %v", err)
+			}
+			want := `<?xml version="1.0" encoding="UTF-8"?>` + "\n" + tt.want + "\n"
+			if got := out.String(); got != want {
+				t.Errorf("Write() =\n%s\nwant\n%s", got, want)
+			}
+		})
+	}
+}
+
+// textAfterChild is the order of <p><b>world</b> again</p>
+func textAfterChild() *schema.KeyOrder {
+	order := schema.NewKeyOrder()
+	p := order.AddKey("p")
+	p.AddKey("b")
+	p.AddKey("#text")
+	return order
+}
@@ -3,19 +3,122 @@
 package writers
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
 	"github.com/loveucifer/aomi/pkg/schema"
 	"gopkg.in/yaml.v3"
 )
 
+// YAMLOptions configures YAML output
+type YAMLOptions struct {
+	Indent int // Spaces per level, 2 to 9; 0 uses the yaml.v3 default of 4
+}
+
 // YAMLWriter writes documents in YAML format
-type YAMLWriter struct{}
+type YAMLWriter struct {
+	YAMLOptions
+}
+
+// NewYAMLWriter creates a YAML writer with the given options
+func NewYAMLWriter(opts YAMLOptions) *YAMLWriter {
+	return &YAMLWriter{YAMLOptions: opts}
+}
+
+// Write writes a document to out as YAML
+func (w *YAMLWriter) Write(ctx context.Context, out io.Writer, doc *schema.Document) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	data, err := w.encode(doc)
+	if err != nil {
+		return err
+	}
+	_, err = out.Write(data)
+	return err
+}
+
+// encode converts a document to YAML bytes. Documents parsed with their
+// YAML nodes keep the comments, anchors and aliases of the source.
+func (w *YAMLWriter) encode(doc *schema.Document) ([]byte, error) {
+	// A stream is written as --- separated documents
+	documents := []interface{}{doc.Data}
+	order := &schema.KeyOrder{Elems: []*schema.KeyOrder{doc.Order}}
+	if items, ok := doc.Data.([]interface{}); ok && doc.Stream {
+		documents, order = items, doc.Order
+	}
 
-// Write converts a document to YAML bytes
-func (w *YAMLWriter) Write(doc *schema.Document) ([]byte, error) {
-	result, err := yaml.Marshal(doc.Data) // :D clean YAML output
+	nodes, err := newYAMLRestorer().restoreList(documents, yamlSourceNodes(doc), order)
 	if err != nil {
 		return nil, err // :0 marshaling failed
 	}
 
-	return result, nil // :) success
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	if w.Indent != 0 {
+		// yaml.v3 would quietly use 2 for anything else
+		if w.Indent < 2 || w.Indent > 9 {
+			return nil, fmt.Errorf("yaml: indent must be between 2 and 9, got %d", w.Indent)
+		}
+		encoder.SetIndent(w.Indent)
+	}
+	for _, node := range nodes {
+		if err := encoder.Encode(node); err != nil { // :D clean YAML output
+			return nil, err // :0 marshaling failed
+		}
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil // :) success
+}
+
+// yamlNode builds a YAML node tree whose mappings follow the key order
+func yamlNode(value interface{}, order *schema.KeyOrder) (*yaml.Node, error) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		node := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+		for _, key := range order.OrderedKeys(v) {
+			keyNode := &yaml.Node{}
+			if err := keyNode.Encode(key); err != nil {
+				return nil, err
+			}
+			valueNode, err := yamlNode(v[key], order.Field(key))
+			if err != nil {
+				return nil, err
+			}
+			node.Content = append(node.Content, keyNode, valueNode)
+		}
+		return node, nil
+	case []interface{}:
+		node := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+		for i, item := range v {
+			itemNode, err := yamlNode(item, order.Elem(i))
+			if err != nil {
+				return nil, err
+			}
+			node.Content = append(node.Content, itemNode)
+		}
+		return node, nil
+	case json.Number:
+		// Exact digits, as a plain scalar that reads back as a number
+		return &yaml.Node{Kind: yaml.ScalarNode, Value: v.String()}, nil
+	case schema.LocalDate:
+		// A plain date reads back as a YAML timestamp
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!timestamp", Value: v.String()}, nil
+	default:
+		node := &yaml.Node{}
+		if err := node.Encode(v); err != nil {
+			return nil, err
+		}
+		if _, ok := v.(float64); ok && !strings.ContainsAny(node.Value, ".eEnN") {
+			node.Tag, node.Value = "!!float", node.Value+".0" // keep whole floats floats
+		}
+		return node, nil
+	}
 }
@@ -0,0 +1,290 @@
+// Package writers provides format-specific writing for Aomi
+// Keeping YAML comments, anchors and aliases through a rewrite :D
+package writers
+
+import (
+	"reflect"
+
+	"github.com/loveucifer/aomi/pkg/parsers"
+	"github.com/loveucifer/aomi/pkg/schema"
+	"gopkg.in/yaml.v3"
+)
+
+// yamlRestorer builds YAML nodes for document data from the nodes the data
+// was parsed from. Unchanged parts reuse their source nodes, so comments,
+// scalar styles, tags, anchors, aliases and merge keys survive; changed
+// parts are rebuilt and keep the comments around them.
+type yamlRestorer struct {
+	anchors map[*yaml.Node]anchoredNode // source anchor -> written node
+	values  map[*yaml.Node]interface{}  // decoded source nodes
+}
+
+// anchoredNode is a written node carrying an anchor, and the data it holds
+type anchoredNode struct {
+	node  *yaml.Node
+	value interface{}
+}
+
+// yamlSourceNodes returns the YAML nodes the YAML parser kept in a
+// document, nil where a document has none
+func yamlSourceNodes(doc *schema.Document) []*yaml.Node {
+	var nodes []*yaml.Node
+	for _, source := range doc.Nodes {
+		node, _ := source.(*yaml.Node)
+		nodes = append(nodes, node)
+	}
+	return nodes
+}
+
+func newYAMLRestorer() *yamlRestorer {
+	return &yamlRestorer{
+		anchors: make(map[*yaml.Node]anchoredNode),
+		values:  make(map[*yaml.Node]interface{}),
+	}
+}
+
+// restore returns the node to write for value, given the source node it
+// came from (nil if none)
+func (r *yamlRestorer) restore(value interface{}, source *yaml.Node, order *schema.KeyOrder) (*yaml.Node, error) {
+	if source == nil {
+		return yamlNode(value, order)
+	}
+
+	node, err := r.restoreKind(value, source, order)
+	if err != nil {
+		return nil, err
+	}
+	if node.Anchor != "" {
+		r.anchors[source] = anchoredNode{node: node, value: value}
+	}
+	return node, nil
+}
+
+func (r *yamlRestorer) restoreKind(value interface{}, source *yaml.Node, order *schema.KeyOrder) (*yaml.Node, error) {
+	switch source.Kind {
+	case yaml.DocumentNode:
+		var content *yaml.Node
+		if len(source.Content) > 0 {
+			content = source.Content[0]
+		}
+		child, err := r.restore(value, content, order)
+		if err != nil {
+			return nil, err
+		}
+		node := *source
+		node.Content = []*yaml.Node{child}
+		return &node, nil
+
+	case yaml.AliasNode:
+		// The alias stays if its anchor was written with the same data
+		if target, ok := r.anchors[source.Alias]; ok && reflect.DeepEqual(target.value, value) {
+			node := *source
+			node.Alias = target.node
+			return &node, nil
+		}
+
+	case yaml.MappingNode:
+		if obj, ok := value.(map[string]interface{}); ok {
+			return r.restoreMapping(obj, source, order)
+		}
+
+	case yaml.SequenceNode:
+		if arr, ok := value.([]interface{}); ok {
+			items, err := r.restoreList(arr, source.Content, order)
+			if err != nil {
+				return nil, err
+			}
+			node := *source
+			node.Content = items
+			return &node, nil
+		}
+
+	case yaml.ScalarNode:
+		if original, ok := r.value(source); ok && reflect.DeepEqual(original, value) {
+			return source, nil
+		}
+	}
+
+	// Changed: write the new value in place of the old one
+	node, err := yamlNode(value, order)
+	if err != nil {
+		return nil, err
+	}
+	if source.Kind != yaml.AliasNode {
+		node.Anchor = source.Anchor
+	}
+	node.HeadComment = source.HeadComment
+	node.LineComment = source.LineComment
+	node.FootComment = source.FootComment
+	return node, nil
+}
+
+// restoreMapping writes the keys of obj in order, reusing the source pairs
+// of keys that are still there. A merge key (<<: *base) stays if every
+// key it brings in still has the merged value or is overridden.
+func (r *yamlRestorer) restoreMapping(obj map[string]interface{}, source *yaml.Node, order *schema.KeyOrder) (*yaml.Node, error) {
+	explicit := make(map[string]int) // key -> index of its pair in source.Content
+	var merges []int
+	for i := 0; i+1 < len(source.Content); i += 2 {
+		if key := source.Content[i]; key.ShortTag() == "!!merge" {
+			merges = append(merges, i)
+		} else {
+			explicit[key.Value] = i
+		}
+	}
+
+	mergePairs, merged := r.restoreMerges(source, merges)
+	keepMerge := mergePairs != nil
+	for key, value := range merged {
+		if current, ok := obj[key]; !ok {
+			keepMerge = false // the merge would bring back a removed key
+		} else if _, ok := explicit[key]; !ok && !reflect.DeepEqual(current, value) {
+			keepMerge = false // a merged value was changed
+		}
+	}
+	mergeWritten := false
+
+	node := *source
+	node.Content = nil
+	for _, key := range order.OrderedKeys(obj) {
+		if i, ok := explicit[key]; ok {
+			value, err := r.restore(obj[key], source.Content[i+1], order.Field(key))
+			if err != nil {
+				return nil, err
+			}
+			node.Content = append(node.Content, source.Content[i], value)
+			continue
+		}
+
+		if _, ok := merged[key]; ok && keepMerge {
+			// Merged keys are written where the merge was
+			if !mergeWritten {
+				node.Content = append(node.Content, mergePairs...)
+				mergeWritten = true
+			}
+			continue
+		}
+
+		keyNode := &yaml.Node{}
+		if err := keyNode.Encode(key); err != nil {
+			return nil, err
+		}
+		value, err := yamlNode(obj[key], order.Field(key))
+		if err != nil {
+			return nil, err
+		}
+		node.Content = append(node.Content, keyNode, value)
+	}
+	// A merge whose keys are all overridden is kept at the end
+	if keepMerge && !mergeWritten {
+		node.Content = append(node.Content, mergePairs...)
+	}
+
+	return &node, nil
+}
+
+// restoreMerges returns the merge pairs of a mapping, pointed at the
+// written anchors, and the keys they bring in. The pairs are nil if an
+// anchor was not written.
+func (r *yamlRestorer) restoreMerges(source *yaml.Node, merges []int) ([]*yaml.Node, map[string]interface{}) {
+	var pairs []*yaml.Node
+	merged := make(map[string]interface{})
+	written := true
+
+	for _, i := range merges {
+		// yaml.v3 writes the resolved tag of a parsed << key as !!merge <<
+		key := *source.Content[i]
+		key.Tag = ""
+		value := source.Content[i+1]
+
+		sources := []*yaml.Node{value}
+		if value.Kind == yaml.SequenceNode {
+			sources = value.Content
+		}
+		restored := make([]*yaml.Node, 0, len(sources))
+		for _, m := range sources {
+			var data interface{}
+			if m.Kind == yaml.AliasNode {
+				target, ok := r.anchors[m.Alias]
+				if !ok {
+					written = false
+					continue
+				}
+				alias := *m
+				alias.Alias = target.node
+				restored = append(restored, &alias)
+				data = target.value
+			} else {
+				data, _ = r.value(m)
+				restored = append(restored, m)
+			}
+
+			// Earlier merges win over later ones
+			mapping, _ := data.(map[string]interface{})
+			for k, v := range mapping {
+				if _, exists := merged[k]; !exists {
+					merged[k] = v
+				}
+			}
+		}
+
+		if value.Kind == yaml.SequenceNode {
+			seq := *value
+			seq.Content = restored
+			pairs = append(pairs, &key, &seq)
+		} else if len(restored) == 1 {
+			pairs = append(pairs, &key, restored[0])
+		}
+	}
+
+	if !written {
+		return nil, merged
+	}
+	return pairs, merged
+}
+
+// restoreList restores the elements of a sequence or a stream. Elements
+// are paired with the source by position when the length is unchanged,
+// otherwise with the next source element holding the same data, so
+// filtered lists keep the comments of the elements that are left. order is
+// the order of the list, holding the order of each element.
+func (r *yamlRestorer) restoreList(values []interface{}, sources []*yaml.Node, order *schema.KeyOrder) ([]*yaml.Node, error) {
+	nodes := make([]*yaml.Node, 0, len(values))
+	next := 0
+	for i, value := range values {
+		var source *yaml.Node
+		if len(values) == len(sources) {
+			source = sources[i]
+		} else {
+			for j := next; j < len(sources); j++ {
+				if original, ok := r.value(sources[j]); ok && reflect.DeepEqual(original, value) {
+					source, next = sources[j], j+1
+					break
+				}
+			}
+		}
+
+		node, err := r.restore(value, source, order.Elem(i))
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, node)
+	}
+	return nodes, nil
+}
+
+// value returns the data a source node was parsed as
+func (r *yamlRestorer) value(source *yaml.Node) (interface{}, bool) {
+	if source == nil {
+		return nil, false
+	}
+	if value, ok := r.values[source]; ok {
+		return value, true
+	}
+	value, err := parsers.YAMLNodeValue(source)
+	if err != nil {
+		return nil, false
+	}
+	r.values[source] = value
+	return value, true
+}
@@ -0,0 +1,159 @@
+package writers
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/loveucifer/aomi/pkg/parsers"
+	"github.com/loveucifer/aomi/pkg/schema"
+)
+
+// Rewriting a parsed YAML document keeps what the data alone can't carry:
+// comments, anchors, aliases and merge keys
+func TestYAMLNodeRestoration(t *testing.T) {
+	tests := []struct {
+		name   string
+		input  string
+		change func(data map[string]interface{})
+		want   string
+	}{
+		{
+			name: "comments survive an unchanged document",
+			input: `# settings
+name: app # the name
+port: 8080
+`,
+			want: `# settings
+name: app # the name
+port: 8080
+`,
+		},
+		{
+			name: "comments survive a changed value",
+			input: `# settings
+name: app # the name
+port: 8080 # default
+`,
+			change: func(data map[string]interface{}) { data["port"] = int64(9090) },
+			want: `# settings
+name: app # the name
+port: 9090 # default
+`,
+		},
+		{
+			name: "anchors and aliases survive",
+			input: `base: &base
+    host: localhost
+copy: *base
+`,
+			want: `base: &base
+    host: localhost
+copy: *base
+`,
+		},
+		{
+			name: "an alias to a changed anchor is expanded",
+			input: `base: &base
+    host: localhost
+copy: *base
+`,
+			change: func(data map[string]interface{}) {
+				data["copy"] = map[string]interface{}{"host": "example.com"}
+			},
+			want: `base: &base
+    host: localhost
+copy:
+    host: example.com
+`,
+		},
+		{
+			name: "merge keys survive",
+			input: `defaults: &defaults
+    retries: 3
+job:
+    <<: *defaults
+    name: build
+`,
+			want: `defaults: &defaults
+    retries: 3
+job:
+    <<: *defaults
+    name: build
+`,
+		},
+		{
+			name: "added keys are written after the kept ones",
+			input: `# settings
+name: app
+`,
+			change: func(data map[string]interface{}) { data["debug"] = true },
+			want: `# settings
+name: app
+debug: true
+`,
+		},
+		{
+			name: "scalar styles survive",
+			input: `quoted: "yes"
+single: 'x'
+block: |
+    line one
+    line two
+`,
+			want: `quoted: "yes"
+single: 'x'
+block: |
+    line one
+    line two
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc := parseYAMLNodes(t, tt.input)
+			if tt.change != nil {
+				tt.change(doc.Data.(map[string]interface{}))
+			}
+
+			var out strings.Builder
+			if err := NewYAMLWriter(YAMLOptions{}).Write(context.Background(), &out, doc); err != nil {
+				t.Fatalf("Write: %v", err)
+			}
+			if got := out.String(); got != tt.want {
+				t.Errorf("Write() =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func parseYAMLNodes(t *testing.T, input string) *schema.Document {
+	t.Helper()
+	parser := &parsers.YAMLParser{PreserveNodes: true}
+	doc, err := parser.Parse(context.Background(), strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	return doc
+}
+
+// Each document of a stream keeps its own comments and anchors
+func TestYAMLNodeRestorationStream(t *testing.T) {
+	input := `# first
+a: &x 1
+b: *x
+---
+# second
+c: 2
+`
+	doc := parseYAMLNodes(t, input)
+
+	var out strings.Builder
+	if err := NewYAMLWriter(YAMLOptions{}).Write(context.Background(), &out, doc); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if got := out.String(); got != input {
+		t.Errorf("Write() =\n%s\nwant\n%s", got, input)
+	}
+}
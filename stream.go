@@ -0,0 +1,79 @@
+// Package aomi converts data between formats from Go code
+// Record-by-record conversion of large inputs :0
+package aomi
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/loveucifer/aomi/pkg/converters"
+	"github.com/loveucifer/aomi/pkg/formats"
+	"github.com/loveucifer/aomi/pkg/parsers"
+	"github.com/loveucifer/aomi/pkg/writers"
+)
+
+// stream converts the input one record at a time. It returns false,
+// without reading anything, when the source parser, a step or the target
+// writer can't stream.
+func (c *config) stream(ctx context.Context, in io.Reader, w io.Writer, prefix []byte, source, target *formats.Format, converter *converters.Converter) (bool, error) {
+	if source.NewParser == nil {
+		return false, nil
+	}
+	parser, ok := source.NewParser().(parsers.StreamingParser)
+	if !ok || !parser.CanStream(prefix) {
+		return false, nil
+	}
+	writer, ok := target.NewWriter().(writers.StreamingWriter)
+	if !ok {
+		return false, nil
+	}
+	steps, ok := converter.RecordSteps(target.ID)
+	if !ok {
+		return false, nil
+	}
+
+	if err := c.configureParser(parser); err != nil {
+		return true, err
+	}
+	if err := c.configureWriter(writer); err != nil {
+		return true, err
+	}
+
+	records, err := parser.Records(ctx, in)
+	if err != nil {
+		return true, fmt.Errorf("parsing input: %v", err) // :0 parsing failed
+	}
+	out, err := writer.Records(ctx, w)
+	if err != nil {
+		return true, fmt.Errorf("writing output: %v", err)
+	}
+	defer writers.Discard(out)
+
+	for i := 0; ; i++ {
+		record, order, err := records.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return true, fmt.Errorf("parsing input: record %d: %v", i, err)
+		}
+
+		record, order, keep, err := converters.ConvertRecord(steps, record, order)
+		if err != nil {
+			return true, fmt.Errorf("converting: record %d: %v", i, err)
+		}
+		if !keep {
+			continue
+		}
+
+		if err := out.WriteRecord(record, order); err != nil {
+			return true, fmt.Errorf("writing output: %v", err)
+		}
+	}
+
+	if err := out.Close(); err != nil {
+		return true, fmt.Errorf("writing output: %v", err)
+	}
+	return true, nil // :) streamed
+}
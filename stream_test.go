@@ -0,0 +1,118 @@
+package aomi
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/loveucifer/aomi/pkg/converters"
+	"github.com/loveucifer/aomi/pkg/writers"
+)
+
+// Streaming must not change the output: every input is converted once
+// record by record and once whole, and both results must match
+func TestStreamedMatchesBuffered(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		opts  []Option
+	}{
+		{
+			name:  "json array to csv, late key",
+			input: `[{"id":1,"name":"a"},{"id":2,"name":"b"},{"id":3,"late":true,"name":"c"}]`,
+			opts:  []Option{From("json"), To("csv")},
+		},
+		{
+			name:  "ndjson to csv, late key",
+			input: "{\"b\":1,\"a\":2}\n{\"a\":3}\n{\"c\":4,\"a\":5}\n",
+			opts:  []Option{From("ndjson"), To("csv")},
+		},
+		{
+			name:  "ndjson to csv, alphabetical columns",
+			input: "{\"b\":1,\"a\":2}\n{\"c\":4,\"a\":5}\n",
+			opts:  []Option{From("ndjson"), To("csv"), CSVOutput(writers.CSVOptions{ColumnOrder: writers.AlphabeticalOrder})},
+		},
+		{
+			name:  "ndjson to csv, nested values",
+			input: "{\"id\":1,\"user\":{\"name\":\"a\",\"tags\":[\"x\",\"y\"]}}\n{\"id\":2,\"user\":{\"name\":\"b\"}}\n",
+			opts:  []Option{From("ndjson"), To("csv")},
+		},
+		{
+			name:  "csv to json",
+			input: "id,price,name\n1,19.90,a\n2,5,b\n",
+			opts:  []Option{From("csv"), To("json")},
+		},
+		{
+			name:  "csv to ndjson",
+			input: "id;city\n1;Paris\n2;London\n",
+			opts:  []Option{From("csv"), To("ndjson")},
+		},
+		{
+			name:  "json array to json, per-record key order",
+			input: `[{"b":1,"a":2},{"c":3,"a":4}]`,
+			opts:  []Option{From("json"), To("json")},
+		},
+		{
+			name:  "json array to ndjson, exact numbers",
+			input: `[{"id":12345678901234567890,"amount":19.90,"n":1.0}]`,
+			opts:  []Option{From("json"), To("ndjson")},
+		},
+		{
+			name:  "filter, rename and select",
+			input: `[{"age":30,"name":"a"},{"age":"n/a","name":"b"},{"age":41,"name":"c"}]`,
+			opts: []Option{From("json"), To("csv"), Steps(
+				mustFilter(t, "age>=35"),
+				converters.Rename(map[string]string{"name": "who"}),
+				converters.Select("who", "age"),
+			)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			streamed := convertString(t, tt.input, append(tt.opts, StreamThreshold(0))...)
+			buffered := convertString(t, tt.input, append(tt.opts, StreamThreshold(1<<20))...)
+			if streamed != buffered {
+				t.Errorf("streamed output differs from buffered\nstreamed:\n%s\nbuffered:\n%s", streamed, buffered)
+			}
+		})
+	}
+}
+
+// A key first seen after the CSV sample is still a column when no sample
+// size is set, however many records come before it
+func TestStreamedCSVLateKey(t *testing.T) {
+	var input strings.Builder
+	for i := 0; i < 5000; i++ {
+		input.WriteString("{\"id\":1}\n")
+	}
+	input.WriteString("{\"id\":2,\"late\":\"x\"}\n")
+
+	output := convertString(t, input.String(), From("ndjson"), To("csv"), StreamThreshold(0))
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	if lines[0] != "id,late" {
+		t.Errorf("header = %q, want %q", lines[0], "id,late")
+	}
+	if last := lines[len(lines)-1]; last != "2,x" {
+		t.Errorf("last row = %q, want %q", last, "2,x")
+	}
+}
+
+func convertString(t *testing.T, input string, opts ...Option) string {
+	t.Helper()
+	var out bytes.Buffer
+	if err := Convert(context.Background(), strings.NewReader(input), &out, opts...); err != nil {
+		t.Fatalf("Convert: %v", err)
+	}
+	return out.String()
+}
+
+func mustFilter(t *testing.T, expr string) converters.Step {
+	t.Helper()
+	keep, err := converters.ParseFilter(expr)
+	if err != nil {
+		t.Fatalf("ParseFilter(%q): %v", expr, err)
+	}
+	return converters.Filter(keep)
+}